@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	alertmanagerDefaultFreshness     = 5 * 3600 // Exceeds the default repeat_interval of 4h
+	alertmanagerDefaultSeverityLabel = "severity"
+	alertmanagerStatusResolved       = "resolved"
+)
+
+var alertmanagerSeverities = map[string]metricStatus{
+	"critical": metricStatusCritical,
+	"error":    metricStatusCritical,
+	"page":     metricStatusCritical,
+	"warning":  metricStatusWarning,
+	"warn":     metricStatusWarning,
+	"info":     metricStatusOK,
+	"none":     metricStatusOK,
+}
+
+type alertmanagerWebhook struct {
+	Version  string              `json:"version"`
+	GroupKey string              `json:"groupKey"`
+	Status   string              `json:"status"`
+	Alerts   []alertmanagerAlert `json:"alerts"`
+}
+
+type alertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+type alertmanagerOptions struct {
+	Freshness     int64
+	IDTemplate    *template.Template
+	SeverityLabel string
+}
+
+// MetricID renders the ID template using the alert labels or falls
+// back to the fingerprint of the alert if no template is given
+func (a alertmanagerAlert) MetricID(tpl *template.Template) (string, error) {
+	if tpl == nil {
+		return a.Fingerprint, nil
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, a.Labels); err != nil {
+		return "", errors.Wrap(err, "Unable to execute ID template")
+	}
+
+	return sanitizeMetricID(strings.TrimSpace(buf.String())), nil
+}
+
+// MetricStatus maps the severity label of firing alerts to a metric status,
+// alerts without known severity are reported as critical
+func (a alertmanagerAlert) MetricStatus(severityLabel string) metricStatus {
+	if a.Status == alertmanagerStatusResolved {
+		return metricStatusOK
+	}
+
+	if s, ok := alertmanagerSeverities[strings.ToLower(a.Labels[severityLabel])]; ok {
+		return s
+	}
+
+	return metricStatusCritical
+}
+
+// Description uses the description or summary annotation and falls back
+// to a list of all annotations
+func (a alertmanagerAlert) Description() string {
+	for _, k := range []string{"description", "summary"} {
+		if v := a.Annotations[k]; v != "" {
+			return v
+		}
+	}
+
+	lines := []string{}
+	for k, v := range a.Annotations {
+		lines = append(lines, k+": "+v)
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
+
+// Title uses the summary annotation and falls back to the alert name
+func (a alertmanagerAlert) Title() string {
+	if v := a.Annotations["summary"]; v != "" {
+		return v
+	}
+	return a.Labels["alertname"]
+}
+
+// applyAlertmanagerWebhook stores every alert of the webhook as a metric
+// reporting the status of the alert
+func (d *dashboard) applyAlertmanagerWebhook(hook alertmanagerWebhook, opts alertmanagerOptions) error {
+	for _, a := range hook.Alerts {
+		metricID, err := a.MetricID(opts.IDTemplate)
+		if err != nil {
+			return invalidDataError(err.Error())
+		}
+
+		if metricID == "" {
+			return invalidDataError("Alert has no fingerprint and ID template rendered empty")
+		}
+
+		update := d.metricUpdateTemplate(metricID)
+		update.Description = truncate(a.Description(), 1024)
+		update.DetailURL = a.GeneratorURL
+		update.Freshness = opts.Freshness
+		update.HideMAD = true
+		update.HideValue = true
+		update.IgnoreMAD = true
+		update.Labels = a.Labels
+		update.Status = a.MetricStatus(opts.SeverityLabel).String()
+		update.Type = metricTypeGauge
+		update.Value = 0
+		update.Values = nil
+
+		if title := a.Title(); title != "" {
+			update.Title = truncate(title, 512)
+		}
+
+		// Resolved alerts are not sent again and must not turn stale
+		update.StalenessStatus = ""
+		if a.Status == alertmanagerStatusResolved {
+			update.StalenessStatus = metricStatusOK.String()
+		}
+
+		if err := d.applyMetricUpdate(metricID, update); err != nil {
+			return errors.Wrapf(err, "Metric %q", metricID)
+		}
+	}
+
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
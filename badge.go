@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"text/template"
+)
+
+const (
+	badgeCharWidth = 7
+	badgePadding   = 10
+)
+
+var (
+	badgeColors = map[string]string{
+		metricStatusOK.String():       "#4c1",
+		metricStatusWarning.String():  "#dfb317",
+		metricStatusCritical.String(): "#e05d44",
+		metricStatusUnknown.String():  "#9f9f9f",
+	}
+
+	badgeTemplate = template.Must(template.New("badge").Funcs(template.FuncMap{
+		"escape": html.EscapeString,
+	}).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{ .Width }}" height="20" role="img" aria-label="{{ escape .Label }}: {{ escape .Message }}">
+<title>{{ escape .Label }}: {{ escape .Message }}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{ .Width }}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="{{ .LabelWidth }}" height="20" fill="#555"/>
+<rect x="{{ .LabelWidth }}" width="{{ .MessageWidth }}" height="20" fill="{{ .Color }}"/>
+<rect width="{{ .Width }}" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{ .LabelCenter }}" y="15" fill="#010101" fill-opacity=".3">{{ escape .Label }}</text>
+<text x="{{ .LabelCenter }}" y="14">{{ escape .Label }}</text>
+<text x="{{ .MessageCenter }}" y="15" fill="#010101" fill-opacity=".3">{{ escape .Message }}</text>
+<text x="{{ .MessageCenter }}" y="14">{{ escape .Message }}</text>
+</g>
+</svg>
+`))
+)
+
+type badge struct {
+	Label   string
+	Message string
+	Color   string
+
+	LabelWidth, MessageWidth, Width int
+	LabelCenter, MessageCenter      float64
+}
+
+// renderBadge creates a shields-style SVG badge coloured by the given
+// metric status
+func renderBadge(label, message, status string) ([]byte, error) {
+	b := badge{
+		Label:   label,
+		Message: message,
+		Color:   badgeColors[status],
+
+		LabelWidth:   len([]rune(label))*badgeCharWidth + badgePadding,
+		MessageWidth: len([]rune(message))*badgeCharWidth + badgePadding,
+	}
+
+	if b.Color == "" {
+		b.Color = badgeColors[metricStatusUnknown.String()]
+	}
+
+	b.Width = b.LabelWidth + b.MessageWidth
+	b.LabelCenter = float64(b.LabelWidth) / 2
+	b.MessageCenter = float64(b.LabelWidth) + float64(b.MessageWidth)/2
+
+	buf := new(bytes.Buffer)
+	err := badgeTemplate.Execute(buf, b)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	mondash "github.com/Luzifer/mondash/client"
+)
+
+var (
+	// Same semantics as the mondash-nagios wrapper, all other exit codes
+	// are reported as unknown
+	checkResultStatusMapping = map[int]metricStatus{
+		0: metricStatusOK,
+		1: metricStatusWarning,
+		2: metricStatusCritical,
+		3: metricStatusUnknown,
+	}
+
+	// Hosts are either up (0) or down / unreachable (1, 2)
+	checkResultHostStatusMapping = map[int]metricStatus{
+		0: metricStatusOK,
+		1: metricStatusCritical,
+		2: metricStatusCritical,
+	}
+
+	icingaFilterHost    = regexp.MustCompile(`host\.name\s*==\s*"([^"]*)"`)
+	icingaFilterService = regexp.MustCompile(`service\.name\s*==\s*"([^"]*)"`)
+)
+
+type checkResult struct {
+	Host      string
+	Service   string
+	ExitCode  int
+	Output    string
+	Timestamp time.Time
+}
+
+// icingaCheckResult contains the fields of the Icinga2 API
+// process-check-result action used to map the result
+type icingaCheckResult struct {
+	Type            string          `json:"type"`
+	Filter          string          `json:"filter"`
+	Host            string          `json:"host"`
+	Service         string          `json:"service"`
+	ExitStatus      *int            `json:"exit_status"`
+	PluginOutput    string          `json:"plugin_output"`
+	PerformanceData perfDataStrings `json:"performance_data"`
+}
+
+// perfDataStrings accepts the perf data as string or list of strings
+type perfDataStrings []string
+
+func (p *perfDataStrings) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*p = perfDataStrings{s}
+		return nil
+	}
+
+	var l []string
+	if err := json.Unmarshal(data, &l); err != nil {
+		return errors.Wrap(err, "performance_data must be string or list of strings")
+	}
+	*p = l
+	return nil
+}
+
+// checkResult converts the Icinga2 action into a check result. The object
+// is taken from the host / service fields, the object parameter in the
+// format "host!service" or the host.name / service.name in the filter.
+func (i icingaCheckResult) checkResult(object string) (checkResult, error) {
+	if i.ExitStatus == nil {
+		return checkResult{}, errors.New("exit_status is required")
+	}
+
+	res := checkResult{
+		Host:     i.Host,
+		Service:  i.Service,
+		ExitCode: *i.ExitStatus,
+		Output:   strings.SplitN(i.PluginOutput, "\n", 2)[0],
+	}
+
+	if len(i.PerformanceData) > 0 && !strings.Contains(res.Output, "|") {
+		res.Output = res.Output + "|" + strings.Join(i.PerformanceData, " ")
+	}
+
+	if res.Host == "" && object != "" {
+		parts := strings.SplitN(object, "!", 2)
+		res.Host = parts[0]
+		if len(parts) == 2 {
+			res.Service = parts[1]
+		}
+	}
+
+	if res.Host == "" {
+		if m := icingaFilterHost.FindStringSubmatch(i.Filter); m != nil {
+			res.Host = m[1]
+		}
+		if m := icingaFilterService.FindStringSubmatch(i.Filter); m != nil {
+			res.Service = m[1]
+		}
+	}
+
+	if res.Host == "" {
+		return checkResult{}, errors.New("Unable to determine host of check result")
+	}
+
+	if strings.EqualFold(i.Type, "host") {
+		res.Service = ""
+	}
+
+	return res, nil
+}
+
+// parseExternalCommands parses passive check results in the external
+// command format as written by NSCA-ng clients:
+//
+//	[<timestamp>] PROCESS_SERVICE_CHECK_RESULT;<host>;<service>;<code>;<output>
+//	[<timestamp>] PROCESS_HOST_CHECK_RESULT;<host>;<code>;<output>
+func parseExternalCommands(body io.Reader, now time.Time) ([]checkResult, error) {
+	var (
+		results = []checkResult{}
+		scanner = bufio.NewScanner(body)
+		lineNo  int
+	)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		res := checkResult{Timestamp: now}
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return nil, errors.Errorf("Line %d: Unterminated timestamp", lineNo)
+			}
+
+			ts, err := strconv.ParseInt(line[1:end], 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Line %d: Invalid timestamp", lineNo)
+			}
+
+			res.Timestamp = time.Unix(ts, 0)
+			line = strings.TrimSpace(line[end+1:])
+		}
+
+		var (
+			fields = strings.SplitN(line, ";", 5)
+			code   string
+		)
+
+		switch {
+		case fields[0] == "PROCESS_SERVICE_CHECK_RESULT" && len(fields) == 5:
+			res.Host, res.Service, code, res.Output = fields[1], fields[2], fields[3], fields[4]
+
+		case fields[0] == "PROCESS_HOST_CHECK_RESULT" && len(fields) >= 4:
+			fields = strings.SplitN(line, ";", 4)
+			res.Host, code, res.Output = fields[1], fields[2], fields[3]
+
+		default:
+			return nil, errors.Errorf("Line %d: Unsupported command", lineNo)
+		}
+
+		exitCode, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Line %d: Invalid return code", lineNo)
+		}
+		res.ExitCode = exitCode
+
+		if res.Host == "" {
+			return nil, errors.Errorf("Line %d: Empty host", lineNo)
+		}
+
+		// Multi-line output is escaped as literal \n in external commands
+		res.Output = strings.SplitN(res.Output, `\n`, 2)[0]
+
+		results = append(results, res)
+	}
+
+	return results, errors.Wrap(scanner.Err(), "Unable to read body")
+}
+
+// MetricID returns "host.service" for service checks or the host name
+func (c checkResult) MetricID() string {
+	id := c.Host
+	if c.Service != "" {
+		id = strings.Join([]string{c.Host, c.Service}, ".")
+	}
+
+	return sanitizeMetricID(id)
+}
+
+// MetricStatus maps the exit code to a metric status
+func (c checkResult) MetricStatus() metricStatus {
+	mapping := checkResultStatusMapping
+	if c.Service == "" {
+		mapping = checkResultHostStatusMapping
+	}
+
+	if s, ok := mapping[c.ExitCode]; ok {
+		return s
+	}
+	return metricStatusUnknown
+}
+
+// applyCheckResults stores the check results as metrics reporting the
+// status of the check and the perf data as values
+func (d *dashboard) applyCheckResults(results []checkResult, freshness int64) error {
+	for _, c := range results {
+		var (
+			metricID              = c.MetricID()
+			output, value, values = mondash.ParsePluginOutput(c.Output)
+		)
+
+		if output == "" {
+			output = "exit " + strconv.Itoa(c.ExitCode)
+		}
+
+		labels := map[string]string{"host": c.Host}
+		if c.Service != "" {
+			labels["service"] = c.Service
+		}
+
+		update := d.metricUpdateTemplate(metricID)
+		update.Description = truncate(output, 1024)
+		update.Freshness = freshness
+		update.HideMAD = true
+		update.IgnoreMAD = true
+		update.Labels = labels
+		update.Status = c.MetricStatus().String()
+		update.Timestamp = c.Timestamp
+		update.Type = metricTypeGauge
+		update.Value = value
+		update.Values = values
+
+		if len(values) < 2 {
+			// The only perf data is already stored as primary value
+			update.Values = nil
+		}
+
+		if err := d.applyMetricUpdate(metricID, update); err != nil {
+			return errors.Wrapf(err, "Metric %q", metricID)
+		}
+	}
+
+	return nil
+}
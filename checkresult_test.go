@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExternalCommands(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		Name   string
+		Body   string
+		Expect []checkResult
+		Err    bool
+	}{
+		{
+			Name: "service check result",
+			Body: "[1604232000] PROCESS_SERVICE_CHECK_RESULT;web01;http;0;HTTP OK|time=0.2s;1;2",
+			Expect: []checkResult{
+				{Host: "web01", Service: "http", ExitCode: 0, Output: "HTTP OK|time=0.2s;1;2", Timestamp: time.Unix(1604232000, 0)},
+			},
+		},
+		{
+			Name: "host check result without timestamp",
+			Body: "PROCESS_HOST_CHECK_RESULT;web01;1;PING CRITICAL; 100% loss",
+			Expect: []checkResult{
+				{Host: "web01", ExitCode: 1, Output: "PING CRITICAL; 100% loss", Timestamp: now},
+			},
+		},
+		{
+			Name: "escaped multi-line output and empty lines",
+			Body: "\n  PROCESS_SERVICE_CHECK_RESULT;db01;disk;2;DISK CRITICAL\\n/var 99%\n\nPROCESS_SERVICE_CHECK_RESULT;db01;load;3;\n",
+			Expect: []checkResult{
+				{Host: "db01", Service: "disk", ExitCode: 2, Output: "DISK CRITICAL", Timestamp: now},
+				{Host: "db01", Service: "load", ExitCode: 3, Output: "", Timestamp: now},
+			},
+		},
+		{Name: "empty body", Body: "", Expect: []checkResult{}},
+		{Name: "unterminated timestamp", Body: "[1604232000 PROCESS_HOST_CHECK_RESULT;web01;0;UP", Err: true},
+		{Name: "invalid timestamp", Body: "[yesterday] PROCESS_HOST_CHECK_RESULT;web01;0;UP", Err: true},
+		{Name: "unsupported command", Body: "SCHEDULE_FORCED_SVC_CHECK;web01;http;1604232000", Err: true},
+		{Name: "missing output", Body: "PROCESS_HOST_CHECK_RESULT;web01;0", Err: true},
+		{Name: "missing service fields", Body: "PROCESS_SERVICE_CHECK_RESULT;web01;0;OK", Err: true},
+		{Name: "invalid return code", Body: "PROCESS_HOST_CHECK_RESULT;web01;up;UP", Err: true},
+		{Name: "empty host", Body: "PROCESS_SERVICE_CHECK_RESULT;;http;0;OK", Err: true},
+		{Name: "oversized line", Body: "PROCESS_HOST_CHECK_RESULT;web01;0;" + strings.Repeat("a", 70*1024), Err: true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			results, err := parseExternalCommands(strings.NewReader(tc.Body), now)
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("Expected error, got %#v", results)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(results, tc.Expect) {
+				t.Errorf("Unexpected results: %#v != %#v", results, tc.Expect)
+			}
+		})
+	}
+}
+
+func TestIcingaCheckResult(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Body   string
+		Object string
+		Expect checkResult
+		Err    bool
+	}{
+		{
+			Name:   "host and service fields",
+			Body:   `{"type": "Service", "host": "web01", "service": "http", "exit_status": 1, "plugin_output": "HTTP WARNING\nslow", "performance_data": "time=2s"}`,
+			Expect: checkResult{Host: "web01", Service: "http", ExitCode: 1, Output: "HTTP WARNING|time=2s"},
+		},
+		{
+			Name:   "object parameter and perf data list",
+			Body:   `{"exit_status": 0, "plugin_output": "OK", "performance_data": ["a=1", "b=2"]}`,
+			Object: "web01!http",
+			Expect: checkResult{Host: "web01", Service: "http", ExitCode: 0, Output: "OK|a=1 b=2"},
+		},
+		{
+			Name:   "filter with perf data in output",
+			Body:   `{"type": "Service", "filter": "host.name==\"web01\" && service.name == \"http\"", "exit_status": 2, "plugin_output": "DOWN|time=0s", "performance_data": "ignored=1"}`,
+			Expect: checkResult{Host: "web01", Service: "http", ExitCode: 2, Output: "DOWN|time=0s"},
+		},
+		{
+			Name:   "host type drops service",
+			Body:   `{"type": "Host", "exit_status": 0, "plugin_output": "UP"}`,
+			Object: "web01!http",
+			Expect: checkResult{Host: "web01", ExitCode: 0, Output: "UP"},
+		},
+		{Name: "missing exit status", Body: `{"host": "web01", "plugin_output": "UP"}`, Err: true},
+		{Name: "missing host", Body: `{"exit_status": 0, "filter": "service.name==\"http\""}`, Err: true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var i icingaCheckResult
+			if err := json.Unmarshal([]byte(tc.Body), &i); err != nil {
+				t.Fatalf("Unable to unmarshal body: %s", err)
+			}
+
+			res, err := i.checkResult(tc.Object)
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("Expected error, got %#v", res)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(res, tc.Expect) {
+				t.Errorf("Unexpected result: %#v != %#v", res, tc.Expect)
+			}
+		})
+	}
+}
+
+func TestCheckResultMetricStatus(t *testing.T) {
+	for _, tc := range []struct {
+		Result checkResult
+		Expect metricStatus
+	}{
+		{checkResult{Host: "web01", Service: "http", ExitCode: 1}, metricStatusWarning},
+		{checkResult{Host: "web01", Service: "http", ExitCode: 42}, metricStatusUnknown},
+		{checkResult{Host: "web01", ExitCode: 1}, metricStatusCritical},
+		{checkResult{Host: "web01", ExitCode: 3}, metricStatusUnknown},
+	} {
+		if s := tc.Result.MetricStatus(); s != tc.Expect {
+			t.Errorf("Unexpected status for %#v: %s != %s", tc.Result, s, tc.Expect)
+		}
+	}
+}
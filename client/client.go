@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
 const defaultHost = "https://mondash.org"
@@ -106,6 +107,21 @@ type PostMetricInput struct {
 	// The metric value to store with the status
 	Value float64 `json:"value"`
 
+	// One of: gauge, counter, heartbeat
+	// For counters the per-second rate since the previous submission is
+	// evaluated instead of the submitted reading
+	// Default: "gauge"
+	Type string `json:"type,omitempty"`
+
+	// Additional named values (for example rx / tx) each having their own
+	// history and evaluation
+	Values map[string]float64 `json:"values,omitempty"`
+
+	// Time the value was measured at, values older than the latest value
+	// are only added to the history
+	// Default: time of submission
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+
 	// Time in seconds when to remove the metric if there is no update (Valid: `0 < x < 604800`)
 	// Default: `604800`
 	Expires int64 `json:"expires,omitempty"`
@@ -118,6 +134,11 @@ type PostMetricInput struct {
 	// Default: false
 	IgnoreMAD bool `json:"ignore_mad,omitempty"`
 
+	// Statistical model used to rate the value when IgnoreMAD is not set
+	// One of: mad, ewma, percentile, rate, seasonal_daily, seasonal_weekly
+	// Default: "mad"
+	Detector string `json:"detector,omitempty"`
+
 	// If set to true the median absolute deviation is hidden on the dashboard for this metric
 	// Default: false
 	HideMAD bool `json:"hide_mad,omitempty"`
@@ -129,6 +150,40 @@ type PostMetricInput struct {
 	// If set this status will be set when the metric gets stale (no updates within freshness time range
 	// Default: "Unknown"
 	StalenessStatus string `json:"staleness_status,omitifempty"`
+
+	// Unit of the value used to format it for display
+	// Known units: bytes, seconds, percent, all other units are appended to the value
+	Unit string `json:"unit,omitempty"`
+
+	// Number of decimals to display the value with (Valid: `0 < x < 10`)
+	// Default: 3
+	Precision *int `json:"precision,omitempty"`
+
+	// Key / value pairs used to match the metric in maintenance windows
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// If set to true the metric is marked as flapping when its status changes too often
+	// Default: false
+	FlapDetection bool `json:"flap_detection,omitempty"`
+
+	// Number of recent results to calculate the percentage of status changes from (Valid: `0 < x < 100`)
+	// Default: 21
+	FlapWindow int `json:"flap_window,omitempty"`
+
+	// Percentage of status changes below which a flapping metric stops flapping
+	// Default: 25
+	FlapThresholdLow float64 `json:"flap_threshold_low,omitempty"`
+
+	// Percentage of status changes above which a metric starts flapping
+	// Default: 50
+	FlapThresholdHigh float64 `json:"flap_threshold_high,omitempty"`
+
+	// If set this status will be set while the metric is flapping
+	FlapStatus Status `json:"flap_status,omitempty"`
+
+	// Number of consecutive results with the same status required before the status changes, applied to the submitted status with IgnoreMAD and to the evaluated status otherwise
+	// Default: 0
+	RequireConsecutive int `json:"require_consecutive,omitempty"`
 }
 
 func (p *PostMetricInput) validate() error {
@@ -171,3 +226,60 @@ type DeleteMetricInput struct {
 func (c *Client) DeleteMetric(input *DeleteMetricInput) error {
 	return c.do(http.MethodDelete, "/"+c.board+"/"+input.MetricID, nil)
 }
+
+// AcknowledgeMetricInput contains parameters for the API request
+type AcknowledgeMetricInput struct {
+	// The unique name for your metric Example: `beer_available`.
+	MetricID string `json:"-"`
+
+	// Name of the person handling the problem
+	Author string `json:"author"`
+
+	// Comment to display with the acknowledgement
+	Comment string `json:"comment"`
+
+	// If set to true the acknowledgement is also removed when the metric changes to any other status
+	// Default: false
+	ClearOnChange bool `json:"clear_on_change,omitempty"`
+}
+
+// AcknowledgeMetric marks a failing metric as handled
+func (c *Client) AcknowledgeMetric(input *AcknowledgeMetricInput) error {
+	buf := bytes.NewBuffer([]byte{})
+	if err := json.NewEncoder(buf).Encode(input); err != nil {
+		return err
+	}
+
+	return c.do(http.MethodPut, "/"+c.board+"/"+input.MetricID+"/ack", buf)
+}
+
+// HeartbeatInput contains parameters for the API request
+type HeartbeatInput struct {
+	// The unique name for your metric Example: `nightly_backup`.
+	MetricID string
+
+	// One of: ping, start, fail
+	// Default: "ping"
+	Event string
+}
+
+// Heartbeat sends a check-in for a heartbeat metric
+func (c *Client) Heartbeat(input *HeartbeatInput) error {
+	event := input.Event
+	if event == "" {
+		event = "ping"
+	}
+
+	return c.do(http.MethodPost, "/"+c.board+"/"+input.MetricID+"/"+event, nil)
+}
+
+// RemoveAcknowledgementInput contains parameters for the API request
+type RemoveAcknowledgementInput struct {
+	// The unique name for your metric Example: `beer_available`.
+	MetricID string
+}
+
+// RemoveAcknowledgement removes the acknowledgement from a metric
+func (c *Client) RemoveAcknowledgement(input *RemoveAcknowledgementInput) error {
+	return c.do(http.MethodDelete, "/"+c.board+"/"+input.MetricID+"/ack", nil)
+}
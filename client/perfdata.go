@@ -0,0 +1,123 @@
+package mondash
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Limits of the named values accepted by the MonDash server
+const (
+	MaxValues          = 32
+	MaxValueNameLength = 64
+)
+
+// ParsePluginOutput splits the output of a Nagios plugin into the text
+// output and its performance data. The perf data named "value" or the
+// first perf data is returned as primary value.
+func ParsePluginOutput(stdout string) (string, float64, map[string]float64) {
+	// Drop everything after first line
+	stdout = strings.SplitN(stdout, "\n", 2)[0]
+
+	// Split output from perf data
+	parts := strings.SplitN(stdout, "|", 2)
+	if len(parts) == 1 {
+		return strings.TrimSpace(parts[0]), 0, nil
+	}
+
+	value, values := ParsePerfData(parts[1])
+	return strings.TrimSpace(parts[0]), value, values
+}
+
+// ParsePerfData parses perf data (label=value[UOM];[warn];[crit];[min];[max])
+// and returns the primary value and all values by their label. Parts not
+// matching this format or having labels longer than MaxValueNameLength
+// are skipped, only the primary value and the first values up to
+// MaxValues are returned.
+func ParsePerfData(perfData string) (float64, map[string]float64) {
+	var (
+		names  = []string{}
+		values = map[string]float64{}
+	)
+
+	for _, part := range splitPerfData(perfData) {
+		tmp := strings.SplitN(part, "=", 2)
+		if len(tmp) != 2 {
+			continue
+		}
+
+		name := strings.Trim(tmp[0], "'")
+		if name == "" || len(name) > MaxValueNameLength {
+			continue
+		}
+
+		// Strip warn / crit / min / max and the unit of measurement
+		rawValue := strings.SplitN(tmp[1], ";", 2)[0]
+		rawValue = strings.TrimRightFunc(rawValue, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+
+		value, err := strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = value
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	primary := names[0]
+	if _, ok := values["value"]; ok {
+		primary = "value"
+	}
+
+	if len(names) > MaxValues {
+		kept := map[string]float64{primary: values[primary]}
+		for _, name := range names {
+			if len(kept) >= MaxValues {
+				break
+			}
+			kept[name] = values[name]
+		}
+		values = kept
+	}
+
+	return values[primary], values
+}
+
+// splitPerfData splits the perf data into its space (or comma) separated
+// parts while respecting quoted labels
+func splitPerfData(perfData string) []string {
+	var (
+		parts   = []string{}
+		current strings.Builder
+		quoted  bool
+	)
+
+	for _, r := range strings.TrimSpace(perfData) {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			current.WriteRune(r)
+
+		case !quoted && (r == ' ' || r == ','):
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+
+	return parts
+}
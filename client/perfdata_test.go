@@ -0,0 +1,121 @@
+package mondash
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePerfData(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Input  string
+		Value  float64
+		Values map[string]float64
+	}{
+		{Name: "empty", Input: ""},
+		{Name: "whitespace only", Input: "   "},
+		{
+			Name:   "single value with unit and thresholds",
+			Input:  "time=0.25s;1;2;0;10",
+			Value:  0.25,
+			Values: map[string]float64{"time": 0.25},
+		},
+		{
+			Name:   "first value is primary",
+			Input:  "rta=12.5ms;100;500 pl=0%;20;60",
+			Value:  12.5,
+			Values: map[string]float64{"rta": 12.5, "pl": 0},
+		},
+		{
+			Name:   "value label is primary",
+			Input:  "load1=0.5, value=3, load5=0.2",
+			Value:  3,
+			Values: map[string]float64{"load1": 0.5, "value": 3, "load5": 0.2},
+		},
+		{
+			Name:   "quoted labels with spaces",
+			Input:  "'/var free'=20GB;5;2 '/'=3.5GB",
+			Value:  20,
+			Values: map[string]float64{"/var free": 20, "/": 3.5},
+		},
+		{
+			Name:   "negative values",
+			Input:  "offset=-0.003s",
+			Value:  -0.003,
+			Values: map[string]float64{"offset": -0.003},
+		},
+		{
+			Name:   "invalid parts are skipped",
+			Input:  "garbage temp=U rate=NaN ''=1 size=12KB",
+			Value:  12,
+			Values: map[string]float64{"size": 12},
+		},
+		{
+			Name:   "duplicate labels keep last value",
+			Input:  "a=1 a=2",
+			Value:  2,
+			Values: map[string]float64{"a": 2},
+		},
+		{
+			Name:   "oversized label is skipped",
+			Input:  strings.Repeat("x", MaxValueNameLength+1) + "=1 ok=2",
+			Value:  2,
+			Values: map[string]float64{"ok": 2},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			value, values := ParsePerfData(tc.Input)
+			if value != tc.Value {
+				t.Errorf("Unexpected primary value: %v != %v", value, tc.Value)
+			}
+			if !reflect.DeepEqual(values, tc.Values) {
+				t.Errorf("Unexpected values: %v != %v", values, tc.Values)
+			}
+		})
+	}
+}
+
+func TestParsePerfDataLimitsValues(t *testing.T) {
+	parts := []string{}
+	for i := 0; i < MaxValues+10; i++ {
+		parts = append(parts, fmt.Sprintf("v%02d=%d", i, i))
+	}
+	parts = append(parts, "value=99")
+
+	value, values := ParsePerfData(strings.Join(parts, " "))
+	if value != 99 {
+		t.Errorf("Unexpected primary value: %v", value)
+	}
+
+	if len(values) != MaxValues {
+		t.Errorf("Unexpected number of values: %d", len(values))
+	}
+
+	if _, ok := values["value"]; !ok {
+		t.Error("Primary value was dropped")
+	}
+	if _, ok := values["v00"]; !ok {
+		t.Error("First value was dropped")
+	}
+}
+
+func TestParsePluginOutput(t *testing.T) {
+	for _, tc := range []struct {
+		Input  string
+		Output string
+		Value  float64
+		Values map[string]float64
+	}{
+		{Input: "", Output: ""},
+		{Input: "DISK OK - free space: / 3326 MB", Output: "DISK OK - free space: / 3326 MB"},
+		{Input: " PING OK | rta=0.5ms;100;500 \nlong output | more=1", Output: "PING OK", Value: 0.5, Values: map[string]float64{"rta": 0.5}},
+		{Input: "CHECK OK|", Output: "CHECK OK"},
+	} {
+		output, value, values := ParsePluginOutput(tc.Input)
+		if output != tc.Output || value != tc.Value || !reflect.DeepEqual(values, tc.Values) {
+			t.Errorf("Unexpected result for %q: %q, %v, %v", tc.Input, output, value, values)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -98,7 +97,7 @@ func main() {
 		exitCode = 3 // Unknown
 	}
 
-	output, value := parseStdout(outputBuffer.String())
+	output, value, values := mondash.ParsePluginOutput(outputBuffer.String())
 	if output == "" {
 		output = fmt.Sprintf("exit %d", exitCode)
 	}
@@ -110,6 +109,7 @@ func main() {
 		Description:     output,
 		Status:          statusMapping[exitCode],
 		Value:           value,
+		Values:          values,
 		Freshness:       int64(cfg.Freshness / time.Second),
 		IgnoreMAD:       true,
 		HideMAD:         true,
@@ -118,54 +118,3 @@ func main() {
 		log.WithError(err).Fatal("Could not submit metric")
 	}
 }
-
-func parseStdout(stdout string) (string, float64) {
-	// Drop everything after first line
-	stdout = strings.SplitN(stdout, "\n", 2)[0]
-
-	// Split output from perf data
-	parts := strings.SplitN(stdout, "|", 2)
-
-	// Return in case there is no perf data
-	if len(parts) == 1 {
-		return parts[0], 0
-	}
-
-	// Save the output
-	output := strings.TrimSpace(parts[0])
-
-	var (
-		perfData = map[string]float64{}
-		fallback string
-	)
-
-	// Parse perf data included in the output
-	perfParts := strings.Split(strings.TrimSpace(parts[1]), ", ")
-	for i, part := range perfParts {
-		tmp := strings.SplitN(part, "=", 2)
-		if len(tmp) != 2 {
-			continue
-		}
-
-		name := tmp[0]
-		value, err := strconv.ParseFloat(tmp[1], 64)
-		if err != nil {
-			log.WithFields(log.Fields{"perf-part": part}).WithError(err).Error("Unable to parse perf data")
-			continue
-		}
-
-		// In case there is a data part "value" use this one
-		if name == "value" {
-			return output, value
-		}
-
-		// Store first seen metric as "fallback"
-		if i == 0 {
-			fallback = name
-		}
-		perfData[name] = value
-	}
-
-	// Return output with first seen metric
-	return output, perfData[fallback]
-}
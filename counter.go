@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// counterRate calculates the per-second rate between two readings of a
+// monotonically increasing counter
+func counterRate(prev, cur, seconds float64) float64 {
+	if cur < prev {
+		// Counter was reset, assume it restarted from zero
+		return cur / seconds
+	}
+	return (cur - prev) / seconds
+}
+
+// convertCounter stores the raw counter readings of the update and
+// replaces them with the per-second rates since the previous readings.
+// If there are no previous readings no rate can be calculated and false
+// is returned.
+func (dm *dashboardMetric) convertCounter(m *dashboardMetric, now time.Time) bool {
+	var (
+		hasPrevious = dm.Type == metricTypeCounter && !dm.Meta.LastUpdate.IsZero()
+		seconds     = now.Sub(dm.Meta.LastUpdate).Seconds()
+		rawValue    = m.Value
+		rawValues   = m.Values
+		rates       = map[string]float64{}
+	)
+
+	defer func() {
+		dm.Counter = rawValue
+		dm.CounterValues = rawValues
+	}()
+
+	if !hasPrevious || seconds <= 0 {
+		m.Value = 0
+		m.Values = nil
+		return false
+	}
+
+	m.Value = counterRate(dm.Counter, rawValue, seconds)
+	for name, v := range rawValues {
+		if prev, ok := dm.CounterValues[name]; ok {
+			rates[name] = counterRate(prev, v, seconds)
+		}
+	}
+	m.Values = rates
+
+	return true
+}
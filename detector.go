@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	defaultDetector = "mad"
+
+	detectorMultiplierWarning  = 3
+	detectorMultiplierCritical = 4
+
+	seasonalMinPoints = 3
+)
+
+// anomalyDetector evaluates the current point of a metric against the
+// baseline formed by the points recorded before it
+type anomalyDetector interface {
+	Evaluate(baseline []dashboardMetricStatus, current dashboardMetricStatus) detectorResult
+}
+
+var anomalyDetectors = map[string]anomalyDetector{
+	"mad":             madDetector{},
+	"ewma":            ewmaDetector{alpha: 0.3},
+	"percentile":      percentileDetector{},
+	"rate":            rateDetector{},
+	"seasonal_daily":  seasonalDetector{period: 24 * time.Hour, window: 30 * time.Minute},
+	"seasonal_weekly": seasonalDetector{period: 7 * 24 * time.Hour, window: time.Hour},
+}
+
+type detectorResult struct {
+	Expected      float64 `json:"expected"`
+	Lower         float64 `json:"lower"`
+	Upper         float64 `json:"upper"`
+	CriticalLower float64 `json:"critical_lower"`
+	CriticalUpper float64 `json:"critical_upper"`
+
+	Status metricStatus `json:"-"`
+}
+
+// neutralResult is used when there is not enough data to make a
+// statement about the value
+func neutralResult(value float64) detectorResult {
+	return detectorResult{
+		Expected:      value,
+		Lower:         value,
+		Upper:         value,
+		CriticalLower: value,
+		CriticalUpper: value,
+		Status:        metricStatusOK,
+	}
+}
+
+// deviationResult builds bounds around the expected value using the
+// given deviation and rates the value by its distance to the expected
+// value measured in multiples of the deviation
+func deviationResult(expected, deviation, value float64) detectorResult {
+	res := detectorResult{
+		Expected:      expected,
+		Lower:         expected - detectorMultiplierWarning*deviation,
+		Upper:         expected + detectorMultiplierWarning*deviation,
+		CriticalLower: expected - detectorMultiplierCritical*deviation,
+		CriticalUpper: expected + detectorMultiplierCritical*deviation,
+		Status:        metricStatusOK,
+	}
+
+	mult := 1.0 // Edge-case, deviation of zero would cause div-by-zero
+	if deviation != 0 {
+		mult = math.Abs(value-expected) / deviation
+	}
+
+	switch {
+	case mult > detectorMultiplierCritical:
+		res.Status = metricStatusCritical
+
+	case mult > detectorMultiplierWarning:
+		res.Status = metricStatusWarning
+	}
+
+	return res
+}
+
+func valuesOf(points []dashboardMetricStatus) []float64 {
+	values := make([]float64, 0, len(points))
+	for _, p := range points {
+		values = append(values, p.Value)
+	}
+	return values
+}
+
+// madDetector rates the value by the median absolute deviation of all
+// known values including the current one
+type madDetector struct{}
+
+func (madDetector) Evaluate(baseline []dashboardMetricStatus, current dashboardMetricStatus) detectorResult {
+	values := append(valuesOf(baseline), current.Value)
+
+	medianValue := median(values)
+	return deviationResult(medianValue, median(absoluteDeviation(values)), current.Value)
+}
+
+// ewmaDetector rates the value by its z-score against the exponentially
+// weighted moving average and variance of the baseline
+type ewmaDetector struct {
+	alpha float64
+}
+
+func (e ewmaDetector) Evaluate(baseline []dashboardMetricStatus, current dashboardMetricStatus) detectorResult {
+	if len(baseline) < 2 {
+		return neutralResult(current.Value)
+	}
+
+	var (
+		avg      = baseline[0].Value
+		variance float64
+	)
+
+	for _, p := range baseline[1:] {
+		diff := p.Value - avg
+		incr := e.alpha * diff
+		avg += incr
+		variance = (1 - e.alpha) * (variance + diff*incr)
+	}
+
+	return deviationResult(avg, math.Sqrt(variance), current.Value)
+}
+
+// percentileDetector marks values outside the 5th to 95th percentile of
+// the baseline as warning and outside the 1st to 99th as critical
+type percentileDetector struct{}
+
+func (percentileDetector) Evaluate(baseline []dashboardMetricStatus, current dashboardMetricStatus) detectorResult {
+	if len(baseline) < 2 {
+		return neutralResult(current.Value)
+	}
+
+	values := valuesOf(baseline)
+	res := detectorResult{
+		Expected:      percentile(values, 50),
+		Lower:         percentile(values, 5),
+		Upper:         percentile(values, 95),
+		CriticalLower: percentile(values, 1),
+		CriticalUpper: percentile(values, 99),
+		Status:        metricStatusOK,
+	}
+
+	switch {
+	case current.Value < res.CriticalLower || current.Value > res.CriticalUpper:
+		res.Status = metricStatusCritical
+
+	case current.Value < res.Lower || current.Value > res.Upper:
+		res.Status = metricStatusWarning
+	}
+
+	return res
+}
+
+// rateDetector rates the change since the last point by the median
+// absolute deviation of the previously seen changes per second
+type rateDetector struct{}
+
+func (rateDetector) Evaluate(baseline []dashboardMetricStatus, current dashboardMetricStatus) detectorResult {
+	if len(baseline) < 2 {
+		return neutralResult(current.Value)
+	}
+
+	rates := []float64{}
+	for i := 1; i < len(baseline); i++ {
+		dt := baseline[i].Time.Sub(baseline[i-1].Time).Seconds()
+		if dt <= 0 {
+			continue
+		}
+		rates = append(rates, (baseline[i].Value-baseline[i-1].Value)/dt)
+	}
+
+	var (
+		last = baseline[len(baseline)-1]
+		dt   = current.Time.Sub(last.Time).Seconds()
+	)
+
+	if len(rates) == 0 || dt <= 0 {
+		return neutralResult(current.Value)
+	}
+
+	medianRate := median(rates)
+	madRate := median(absoluteDeviation(rates))
+
+	// Translate the rate bounds back into value space
+	return deviationResult(last.Value+medianRate*dt, madRate*dt, current.Value)
+}
+
+// seasonalDetector rates the value by the median absolute deviation of
+// the values seen around the same time in previous periods
+type seasonalDetector struct {
+	period time.Duration
+	window time.Duration
+}
+
+func (s seasonalDetector) Evaluate(baseline []dashboardMetricStatus, current dashboardMetricStatus) detectorResult {
+	seasonal := []dashboardMetricStatus{}
+
+	for _, p := range baseline {
+		diff := current.Time.Sub(p.Time)
+		periods := math.Round(float64(diff) / float64(s.period))
+		if periods < 1 {
+			continue
+		}
+
+		if offset := diff - time.Duration(periods)*s.period; offset <= s.window && offset >= -s.window {
+			seasonal = append(seasonal, p)
+		}
+	}
+
+	if len(seasonal) < seasonalMinPoints {
+		// Not enough history for the period yet, use the whole baseline
+		return madDetector{}.Evaluate(baseline, current)
+	}
+
+	return madDetector{}.Evaluate(seasonal, current)
+}
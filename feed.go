@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+	Content string   `xml:"content,omitempty"`
+}
+
+type statusTransition struct {
+	Time  time.Time `json:"time"`
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Value float64   `json:"value"`
+}
+
+// StatusTransitions lists all changes of the reported status recorded
+// after the given time, oldest first
+func (dm dashboardMetric) StatusTransitions(since time.Time) []statusTransition {
+	transitions := []statusTransition{}
+
+	for _, c := range dm.StatusChanges {
+		if !c.Time.Before(since) {
+			transitions = append(transitions, c)
+		}
+	}
+
+	return transitions
+}
+
+// buildStatusFeed creates an Atom feed of all status transitions of the
+// dashboard metrics, newest first
+func buildStatusFeed(dash *dashboard, since time.Time) atomFeed {
+	var (
+		dashURL = fmt.Sprintf("%s/%s", cfg.BaseURL, dash.DashboardID)
+		updated time.Time
+	)
+
+	feed := atomFeed{
+		ID:     dashURL,
+		Title:  fmt.Sprintf("MonDash %s: Status changes", dash.DashboardID),
+		Author: atomAuthor{Name: "MonDash"},
+		Links: []atomLink{
+			{Href: dashURL},
+			{Href: dashURL + "/feed.atom", Rel: "self"},
+		},
+	}
+
+	type feedItem struct {
+		metric     *dashboardMetric
+		transition statusTransition
+	}
+	items := []feedItem{}
+
+	for _, m := range dash.Metrics {
+		for _, t := range m.StatusTransitions(since) {
+			items = append(items, feedItem{metric: m, transition: t})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[j].transition.Time.Before(items[i].transition.Time) })
+
+	for _, item := range items {
+		if item.transition.Time.After(updated) {
+			updated = item.transition.Time
+		}
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			// The ID must not change between requests for the same transition
+			ID:      fmt.Sprintf("%s/%s#%d", dashURL, item.metric.MetricID, item.transition.Time.UnixNano()),
+			Title:   fmt.Sprintf("%s: %s → %s", item.metric.Title, item.transition.From, item.transition.To),
+			Updated: item.transition.Time.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: dashURL},
+			Summary: fmt.Sprintf("Status of %q changed from %s to %s at %s (value: %g)",
+				item.metric.Title, item.transition.From, item.transition.To,
+				item.transition.Time.UTC().Format(time.RFC1123), item.transition.Value),
+			Content: item.metric.Description,
+		})
+	}
+
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	return feed
+}
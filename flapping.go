@@ -0,0 +1,131 @@
+package main
+
+const (
+	defaultFlapWindow        = 21
+	defaultFlapThresholdLow  = 25.0
+	defaultFlapThresholdHigh = 50.0
+
+	// Weights applied to the oldest and newest state change inside the
+	// flap window, changes in between are weighted linearly
+	flapWeightOldest = 0.8
+	flapWeightNewest = 1.2
+
+	maxFlapWindow         = 100
+	maxRequireConsecutive = 100
+)
+
+// flapPercentage calculates the weighted percentage of state changes
+// within the given statuses (oldest first) like Nagios does
+func flapPercentage(statuses []string) float64 {
+	if len(statuses) < 2 {
+		return 0
+	}
+
+	var (
+		changes, total float64
+		steps          = len(statuses) - 2
+	)
+
+	for i := 1; i < len(statuses); i++ {
+		weight := flapWeightOldest
+		if steps > 0 {
+			weight += (flapWeightNewest - flapWeightOldest) * float64(i-1) / float64(steps)
+		}
+
+		total += weight
+		if statuses[i] != statuses[i-1] {
+			changes += weight
+		}
+	}
+
+	return changes / total * 100
+}
+
+func (dm dashboardMetric) flapWindow() int {
+	if dm.FlapWindow == 0 {
+		return defaultFlapWindow
+	}
+	return dm.FlapWindow
+}
+
+func (dm dashboardMetric) flapThresholds() (low, high float64) {
+	low, high = dm.FlapThresholdLow, dm.FlapThresholdHigh
+	if low == 0 {
+		low = defaultFlapThresholdLow
+	}
+	if high == 0 {
+		high = defaultFlapThresholdHigh
+	}
+	return low, high
+}
+
+// updateFlapping recalculates the flap percentage from the recently
+// evaluated statuses and toggles the flapping state using the low and
+// high thresholds as hysteresis
+func (dm *dashboardMetric) updateFlapping() {
+	if !dm.FlapDetection {
+		dm.Meta.Flapping = false
+		dm.Meta.FlapPercentage = 0
+		return
+	}
+
+	start := len(dm.Meta.RecentStatuses) - dm.flapWindow()
+	if start < 0 {
+		start = 0
+	}
+
+	dm.Meta.FlapPercentage = flapPercentage(dm.Meta.RecentStatuses[start:])
+
+	low, high := dm.flapThresholds()
+	switch {
+	case !dm.Meta.Flapping && dm.Meta.FlapPercentage >= high:
+		dm.Meta.Flapping = true
+
+	case dm.Meta.Flapping && dm.Meta.FlapPercentage < low:
+		dm.Meta.Flapping = false
+	}
+}
+
+// evaluatedStatus returns the status of the latest update before the
+// hysteresis is applied: The submitted status if MAD is ignored or for
+// heartbeats having no meaningful value to evaluate, the status of the
+// detector otherwise
+func (dm dashboardMetric) evaluatedStatus() string {
+	if dm.IgnoreMAD || dm.Type == metricTypeHeartbeat {
+		return dm.Status
+	}
+	return dm.StatisticalStatus()
+}
+
+// updateEvaluatedStatus records the evaluated status of the latest
+// update for the flap detection and switches the stable status once the
+// same status was evaluated RequireConsecutive times in a row
+func (dm *dashboardMetric) updateEvaluatedStatus() {
+	status := dm.evaluatedStatus()
+
+	dm.Meta.RecentStatuses = append(dm.Meta.RecentStatuses, status)
+	if n := len(dm.Meta.RecentStatuses); n > maxFlapWindow {
+		dm.Meta.RecentStatuses = dm.Meta.RecentStatuses[n-maxFlapWindow:]
+	}
+
+	if status == dm.Meta.PendingStatus {
+		dm.Meta.PendingCount++
+	} else {
+		dm.Meta.PendingStatus = status
+		dm.Meta.PendingCount = 1
+	}
+
+	if dm.Meta.StableStatus == "" || dm.Meta.PendingCount >= dm.RequireConsecutive {
+		dm.Meta.StableStatus = status
+	}
+}
+
+// stableStatus returns the latest evaluated status which was reached at
+// least RequireConsecutive times in a row: The previous stable status is
+// kept as long as no other status reached that count
+func (dm dashboardMetric) stableStatus() string {
+	if dm.RequireConsecutive < 2 || dm.Meta.StableStatus == "" {
+		return dm.evaluatedStatus()
+	}
+	return dm.Meta.StableStatus
+}
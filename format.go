@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPrecision = 3
+	maxPrecision     = 10
+	maxUnitLength    = 32
+)
+
+var (
+	byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+	durationUnits = []struct {
+		suffix  string
+		seconds float64
+	}{
+		{"d", 86400},
+		{"h", 3600},
+		{"m", 60},
+		{"s", 1},
+	}
+
+	valueFormatters = map[string]func(v float64, precision int) string{
+		"bytes":   formatBytes,
+		"percent": func(v float64, precision int) string { return strconv.FormatFloat(v, 'f', precision, 64) + "%" },
+		"seconds": formatSeconds,
+	}
+)
+
+// formatValue creates a human readable representation of the value
+// using the given unit: Known units (bytes, percent, seconds) are
+// formatted specially, all others are appended to the value
+func formatValue(v float64, unit string, precision int) string {
+	if f, ok := valueFormatters[unit]; ok {
+		return f(v, precision)
+	}
+
+	out := strconv.FormatFloat(v, 'f', precision, 64)
+	if unit != "" {
+		out = strings.Join([]string{out, unit}, " ")
+	}
+
+	return out
+}
+
+func formatBytes(v float64, precision int) string {
+	var (
+		abs = math.Abs(v)
+		i   int
+	)
+
+	for abs >= 1024 && i < len(byteUnits)-1 {
+		abs /= 1024
+		v /= 1024
+		i++
+	}
+
+	if i == 0 {
+		return fmt.Sprintf("%s B", strconv.FormatFloat(v, 'f', 0, 64))
+	}
+
+	return fmt.Sprintf("%s %s", strconv.FormatFloat(v, 'f', precision, 64), byteUnits[i])
+}
+
+func formatSeconds(v float64, precision int) string {
+	var (
+		abs  = math.Abs(v)
+		sign string
+	)
+
+	if v < 0 {
+		sign = "-"
+	}
+
+	switch {
+	case abs < 1:
+		return sign + strconv.FormatFloat(abs*1000, 'f', precision, 64) + "ms"
+
+	case abs < 60:
+		return sign + strconv.FormatFloat(abs, 'f', precision, 64) + "s"
+	}
+
+	var (
+		parts     = []string{}
+		remaining = math.Round(abs)
+	)
+
+	for _, u := range durationUnits {
+		if n := math.Floor(remaining / u.seconds); n > 0 {
+			parts = append(parts, fmt.Sprintf("%.0f%s", n, u.suffix))
+			remaining -= n * u.seconds
+		}
+	}
+
+	return sign + strings.Join(parts, " ")
+}
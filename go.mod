@@ -2,8 +2,11 @@ module github.com/Luzifer/mondash
 
 go 1.15
 
+replace github.com/Luzifer/mondash/client => ./client
+
 require (
 	github.com/Luzifer/go_helpers/v2 v2.11.0
+	github.com/Luzifer/mondash/client v0.0.0-20201018014217-9635a0446be0
 	github.com/Luzifer/rconfig/v2 v2.2.1
 	github.com/aws/aws-sdk-go v1.35.9
 	github.com/gorilla/mux v1.8.0
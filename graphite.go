@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	graphiteMaxBatchSize  = 500
+	graphiteMaxLineLength = 4096
+)
+
+type graphitePrefix struct {
+	Prefix      string
+	DashboardID string
+	Token       string
+}
+
+type graphitePoint struct {
+	DashboardID string
+	MetricID    string
+	Token       string
+	Time        time.Time
+	Value       float64
+}
+
+// graphiteListener receives metrics using the Graphite plaintext protocol
+// (path value timestamp) via TCP. The path is mapped to a dashboard using
+// the configured prefixes, the remainder of the path is used as metric ID.
+type graphiteListener struct {
+	prefixes []graphitePrefix
+}
+
+// parseGraphitePrefixes parses prefix=dashid:token mappings sorted by
+// descending prefix length to match the most specific prefix first
+func parseGraphitePrefixes(mappings []string) ([]graphitePrefix, error) {
+	prefixes := []graphitePrefix{}
+	for _, mapping := range mappings {
+		if mapping == "" {
+			continue
+		}
+
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("Invalid prefix mapping %q", mapping)
+		}
+
+		target := strings.SplitN(parts[1], ":", 2)
+		if len(target) != 2 || target[0] == "" || target[1] == "" {
+			return nil, errors.Errorf("Invalid prefix mapping %q", mapping)
+		}
+
+		prefixes = append(prefixes, graphitePrefix{
+			Prefix:      strings.TrimSuffix(parts[0], "."),
+			DashboardID: target[0],
+			Token:       target[1],
+		})
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i].Prefix) > len(prefixes[j].Prefix) })
+
+	return prefixes, nil
+}
+
+// Listen accepts connections on the given TCP address
+func (g graphiteListener) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "Unable to listen for Graphite connections")
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return errors.Wrap(err, "Unable to accept Graphite connection")
+		}
+
+		go g.handleConnection(conn)
+	}
+}
+
+// handleConnection reads lines from the connection and applies them in
+// batches whenever no more data is buffered or the batch is full. The
+// connection is closed when a line exceeds graphiteMaxLineLength.
+func (g graphiteListener) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	var (
+		batch  = []graphitePoint{}
+		reader = bufio.NewReaderSize(conn, graphiteMaxLineLength)
+	)
+
+	for {
+		raw, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			raw, err = nil, errors.New("Line exceeds maximum length")
+		}
+
+		if line := strings.TrimSpace(string(raw)); line != "" {
+			p, perr := g.parseLine(line, time.Now())
+			if perr != nil {
+				log.WithError(perr).WithField("line", line).Debug("Discarded Graphite line")
+			} else {
+				batch = append(batch, p)
+			}
+		}
+
+		if len(batch) > 0 && (err != nil || reader.Buffered() == 0 || len(batch) >= graphiteMaxBatchSize) {
+			g.applyPoints(batch)
+			batch = []graphitePoint{}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				log.WithError(err).Debug("Graphite connection failed")
+			}
+			return
+		}
+	}
+}
+
+// parseLine parses a "path value timestamp" line, a missing or negative
+// timestamp is replaced by the given time
+func (g graphiteListener) parseLine(line string, now time.Time) (graphitePoint, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return graphitePoint{}, errors.New("Line does not match path value timestamp")
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return graphitePoint{}, errors.Wrap(err, "Invalid value")
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return graphitePoint{}, errors.New("Value is not a number")
+	}
+
+	p := graphitePoint{Time: now, Value: value}
+	if len(fields) == 3 {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return graphitePoint{}, errors.Wrap(err, "Invalid timestamp")
+		}
+		if ts >= 0 {
+			sec, frac := math.Modf(ts)
+			p.Time = time.Unix(int64(sec), int64(frac*float64(time.Second)))
+		}
+	}
+
+	for _, prefix := range g.prefixes {
+		if strings.HasPrefix(fields[0], prefix.Prefix+".") {
+			p.DashboardID = prefix.DashboardID
+			p.MetricID = sanitizeMetricID(strings.TrimPrefix(fields[0], prefix.Prefix+"."))
+			p.Token = prefix.Token
+			return p, nil
+		}
+	}
+
+	return graphitePoint{}, errors.New("No prefix configured for path")
+}
+
+// applyPoints applies the points in chronological order to their
+// dashboards, saving every dashboard once
+func (g graphiteListener) applyPoints(points []graphitePoint) {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+
+	dashboards := map[string][]graphitePoint{}
+	for _, p := range points {
+		dashboards[p.DashboardID] = append(dashboards[p.DashboardID], p)
+	}
+
+	for dashID, points := range dashboards {
+		if err := g.applyDashboardPoints(dashID, points); err != nil {
+			log.WithError(err).WithField("dashboard_id", dashID).Error("Unable to apply Graphite metrics")
+		}
+	}
+}
+
+func (g graphiteListener) applyDashboardPoints(dashID string, points []graphitePoint) error {
+	return updateStoredDashboard(dashID, points[0].Token, store, func(dash *dashboard) error {
+		for _, p := range points {
+			update := dash.metricUpdateTemplate(p.MetricID)
+			update.Type = metricTypeGauge
+			update.Status = metricStatusOK.String()
+			update.Timestamp = p.Time
+			update.Value = p.Value
+			update.Values = nil
+
+			if err := dash.applyMetricUpdate(p.MetricID, update); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"dashboard_id": dashID,
+					"metric_id":    p.MetricID,
+				}).Error("Unable to apply Graphite metric")
+			}
+		}
+
+		return nil
+	})
+}
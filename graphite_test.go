@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphiteParseLine(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	prefixes, err := parseGraphitePrefixes([]string{"servers=infra:secret", "servers.db.=db:token"})
+	if err != nil {
+		t.Fatalf("Unable to parse prefixes: %s", err)
+	}
+	g := graphiteListener{prefixes: prefixes}
+
+	for _, tc := range []struct {
+		Name   string
+		Line   string
+		Expect graphitePoint
+		Err    bool
+	}{
+		{
+			Name:   "with timestamp",
+			Line:   "servers.web01.load 0.5 1604232000",
+			Expect: graphitePoint{DashboardID: "infra", MetricID: "web01.load", Token: "secret", Time: time.Unix(1604232000, 0), Value: 0.5},
+		},
+		{
+			Name:   "fractional timestamp",
+			Line:   "servers.web01.load 1 1604232000.25",
+			Expect: graphitePoint{DashboardID: "infra", MetricID: "web01.load", Token: "secret", Time: time.Unix(1604232000, int64(250*time.Millisecond)), Value: 1},
+		},
+		{
+			Name:   "without timestamp",
+			Line:   "servers.web01.load 2",
+			Expect: graphitePoint{DashboardID: "infra", MetricID: "web01.load", Token: "secret", Time: now, Value: 2},
+		},
+		{
+			Name:   "negative timestamp uses current time",
+			Line:   "servers.web01.load 3 -1",
+			Expect: graphitePoint{DashboardID: "infra", MetricID: "web01.load", Token: "secret", Time: now, Value: 3},
+		},
+		{
+			Name:   "most specific prefix and tab separators",
+			Line:   "servers.db.main/disk\t-4e2",
+			Expect: graphitePoint{DashboardID: "db", MetricID: "main_disk", Token: "token", Time: now, Value: -400},
+		},
+		{Name: "empty line", Line: "", Err: true},
+		{Name: "missing value", Line: "servers.web01.load", Err: true},
+		{Name: "too many fields", Line: "servers.web01.load 1 1604232000 extra", Err: true},
+		{Name: "invalid value", Line: "servers.web01.load one", Err: true},
+		{Name: "NaN value", Line: "servers.web01.load nan", Err: true},
+		{Name: "infinite value", Line: "servers.web01.load +Inf", Err: true},
+		{Name: "invalid timestamp", Line: "servers.web01.load 1 yesterday", Err: true},
+		{Name: "unknown prefix", Line: "network.switch01.ports 48", Err: true},
+		{Name: "prefix without metric", Line: "servers 1", Err: true},
+		{Name: "partial prefix match", Line: "serversfoo.load 1", Err: true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			p, err := g.parseLine(tc.Line, now)
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("Expected error for line %q, got %#v", tc.Line, p)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(p, tc.Expect) {
+				t.Errorf("Unexpected point: %#v != %#v", p, tc.Expect)
+			}
+		})
+	}
+}
+
+func TestParseGraphitePrefixes(t *testing.T) {
+	prefixes, err := parseGraphitePrefixes([]string{"", "a=short:t1", "a.b.c.=long:t:2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expect := []graphitePrefix{
+		{Prefix: "a.b.c", DashboardID: "long", Token: "t:2"},
+		{Prefix: "a", DashboardID: "short", Token: "t1"},
+	}
+	if !reflect.DeepEqual(prefixes, expect) {
+		t.Errorf("Unexpected prefixes: %#v != %#v", prefixes, expect)
+	}
+
+	for _, mapping := range []string{"a", "=dash:token", "a=dash", "a=:token", "a=dash:"} {
+		if _, err := parseGraphitePrefixes([]string{mapping}); err == nil {
+			t.Errorf("Expected error for mapping %q", mapping)
+		}
+	}
+}
+
+func TestGraphiteOversizedLineClosesConnection(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		graphiteListener{}.handleConnection(server)
+		close(done)
+	}()
+
+	// The pipe is unbuffered: The write fails as soon as the listener
+	// stopped reading the line and closed the connection
+	if _, err := client.Write([]byte("servers.web01.load " + strings.Repeat("1", 2*graphiteMaxLineLength) + "\n")); err == nil {
+		t.Error("Expected write to fail on closed connection")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Connection was not closed")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	heartbeatEventFail  = "fail"
+	heartbeatEventPing  = "ping"
+	heartbeatEventStart = "start"
+)
+
+// isCheckIn reports whether the request is routed to one of the
+// heartbeat check-in endpoints
+func isCheckIn(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+
+	for _, event := range []string{heartbeatEventFail, heartbeatEventPing, heartbeatEventStart} {
+		if tpl == "/{dashid}/{metricid}/"+event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkInToken extracts the API token of a check-in request which
+// might also be passed as "token" query parameter as cron jobs might
+// not be able to set headers
+func checkInToken(r *http.Request) string {
+	if token := requestToken(r); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// recordHeartbeat registers a check-in of the heartbeat metric with the
+// given ID, creating the metric if required: A "start" event only notes
+// the start of the job while "ping" and "fail" report the job finished
+// successfully or failed and record the job duration as value if a start
+// was noted before. A freshness of 0 keeps the configured freshness.
+func (d *dashboard) recordHeartbeat(metricID, event string, freshness int64, now time.Time) error {
+	m := d.getMetric(metricID)
+	if m == nil {
+		if err := validateMetricID(metricID); err != nil {
+			return err
+		}
+
+		if err := d.checkMetricQuota(metricID); err != nil {
+			return err
+		}
+
+		m = newDashboardMetric()
+		m.MetricID = metricID
+		m.Title = metricID
+		m.Type = metricTypeHeartbeat
+		m.Unit = "seconds"
+		// Without a last update the metric would be hidden as expired
+		// and never turn stale if the first run does not finish
+		m.Meta.LastUpdate = now
+		d.Metrics = append(d.Metrics, m)
+	}
+
+	if event == heartbeatEventStart {
+		m.Meta.JobStart = &now
+		if freshness > 0 {
+			m.Freshness = freshness
+		}
+		return nil
+	}
+
+	// Re-use the current configuration of the metric for the check-in
+	update := *m
+	update.Type = metricTypeHeartbeat
+	update.Freshness = freshness
+	update.Status = metricStatusOK.String()
+	update.Value = 0
+	update.Values = nil
+
+	if event == heartbeatEventFail {
+		update.Status = metricStatusCritical.String()
+	}
+
+	if m.Meta.JobStart != nil {
+		update.Value = now.Sub(*m.Meta.JobStart).Seconds()
+		m.Meta.JobStart = nil
+	}
+
+	return d.applyMetricUpdate(metricID, &update)
+}
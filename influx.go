@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var influxPrecisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+type influxPoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	Time        time.Time
+}
+
+// MetricID builds the metric ID from the measurement and the tag values
+// sorted by their tag keys
+func (i influxPoint) MetricID() string {
+	keys := []string{}
+	for k := range i.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{i.Measurement}
+	for _, k := range keys {
+		parts = append(parts, i.Tags[k])
+	}
+
+	return sanitizeMetricID(strings.Join(parts, "."))
+}
+
+// PrimaryValue returns the field named "value" or the alphabetically
+// first field if there is no such field
+func (i influxPoint) PrimaryValue() float64 {
+	if v, ok := i.Fields["value"]; ok {
+		return v
+	}
+
+	keys := []string{}
+	for k := range i.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return i.Fields[keys[0]]
+}
+
+// parseInfluxLines parses a body in InfluxDB line protocol using the
+// given precision for the timestamps
+func parseInfluxLines(body io.Reader, precision time.Duration, now time.Time) ([]influxPoint, error) {
+	var (
+		points  = []influxPoint{}
+		scanner = bufio.NewScanner(body)
+		lineNo  int
+	)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := parseInfluxLine(line, precision, now)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Line %d", lineNo)
+		}
+
+		if p != nil {
+			points = append(points, *p)
+		}
+	}
+
+	return points, errors.Wrap(scanner.Err(), "Unable to read body")
+}
+
+// parseInfluxLine parses a single line. Lines without any numeric or
+// boolean field are skipped and nil is returned.
+func parseInfluxLine(line string, precision time.Duration, now time.Time) (*influxPoint, error) {
+	sections := splitInfluxEscaped(line, ' ')
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, errors.New("Line does not match measurement,tags fields timestamp")
+	}
+
+	series := splitInfluxEscaped(sections[0], ',')
+	p := &influxPoint{
+		Measurement: unescapeInflux(series[0]),
+		Tags:        map[string]string{},
+		Fields:      map[string]float64{},
+		Time:        now,
+	}
+
+	if p.Measurement == "" {
+		return nil, errors.New("Empty measurement")
+	}
+
+	for _, tag := range series[1:] {
+		kv := splitInfluxEscaped(tag, '=')
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("Invalid tag %q", tag)
+		}
+		p.Tags[unescapeInflux(kv[0])] = unescapeInflux(kv[1])
+	}
+
+	for _, field := range splitInfluxEscaped(sections[1], ',') {
+		kv := splitInfluxEscaped(field, '=')
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, errors.Errorf("Invalid field %q", field)
+		}
+
+		v, ok, err := parseInfluxFieldValue(kv[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid field %q", field)
+		}
+
+		if ok {
+			p.Fields[unescapeInflux(kv[0])] = v
+		}
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid timestamp")
+		}
+		p.Time = time.Unix(0, ts*int64(precision))
+	}
+
+	if len(p.Fields) == 0 {
+		return nil, nil
+	}
+
+	return p, nil
+}
+
+// parseInfluxFieldValue converts a field value into a float. String
+// fields are valid but can not be stored and therefore are reported
+// as not ok.
+func parseInfluxFieldValue(v string) (float64, bool, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		if len(v) < 2 || !strings.HasSuffix(v, `"`) {
+			return 0, false, errors.New("Unterminated string")
+		}
+		return 0, false, nil
+
+	case v == "t" || v == "T" || v == "true" || v == "True" || v == "TRUE":
+		return 1, true, nil
+
+	case v == "f" || v == "F" || v == "false" || v == "False" || v == "FALSE":
+		return 0, true, nil
+
+	case strings.HasSuffix(v, "i"), strings.HasSuffix(v, "u"):
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		return float64(i), err == nil, err
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return 0, false, errors.New("Value is not a number")
+	}
+	return f, err == nil, err
+}
+
+// splitInfluxEscaped splits the string on every separator neither
+// escaped by a backslash nor contained in a double-quoted string
+func splitInfluxEscaped(s string, sep byte) []string {
+	var (
+		parts   = []string{}
+		start   int
+		escaped bool
+		quoted  bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func unescapeInflux(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\"`, `"`, `\\`, `\`).Replace(s)
+}
+
+// applyInfluxPoints applies the points in chronological order to the
+// dashboard using the tags as labels and the fields as named values
+func (d *dashboard) applyInfluxPoints(points []influxPoint) error {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+
+	for _, p := range points {
+		metricID := p.MetricID()
+
+		update := d.metricUpdateTemplate(metricID)
+		update.Labels = p.Tags
+		update.Status = metricStatusOK.String()
+		update.Timestamp = p.Time
+		update.Type = metricTypeGauge
+		update.Value = p.PrimaryValue()
+		update.Values = p.Fields
+
+		if len(p.Fields) == 1 {
+			// The only field is already stored as primary value
+			update.Values = nil
+		}
+
+		if err := d.applyMetricUpdate(metricID, update); err != nil {
+			return errors.Wrapf(err, "Metric %q", metricID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		Name      string
+		Line      string
+		Precision time.Duration
+		Expect    *influxPoint
+		Err       bool
+	}{
+		{
+			Name:   "fields only",
+			Line:   "cpu value=12.5,idle=80i",
+			Expect: &influxPoint{Measurement: "cpu", Tags: map[string]string{}, Fields: map[string]float64{"value": 12.5, "idle": 80}, Time: now},
+		},
+		{
+			Name:   "tags and nanosecond timestamp",
+			Line:   "cpu,host=web01,region=eu value=1 1604232000000000000",
+			Expect: &influxPoint{Measurement: "cpu", Tags: map[string]string{"host": "web01", "region": "eu"}, Fields: map[string]float64{"value": 1}, Time: time.Unix(1604232000, 0)},
+		},
+		{
+			Name:      "timestamp with precision",
+			Line:      "cpu value=1 1604232000",
+			Precision: time.Second,
+			Expect:    &influxPoint{Measurement: "cpu", Tags: map[string]string{}, Fields: map[string]float64{"value": 1}, Time: time.Unix(1604232000, 0)},
+		},
+		{
+			Name:   "escaped measurement, tags and fields",
+			Line:   `disk\ io,path=C:\\data,mount\=point=a\,b read\ ops=3u`,
+			Expect: &influxPoint{Measurement: "disk io", Tags: map[string]string{"path": `C:\data`, "mount=point": "a,b"}, Fields: map[string]float64{"read ops": 3}, Time: now},
+		},
+		{
+			Name:   "quoted string field containing separators",
+			Line:   `app msg="up, and running=yes",value=t`,
+			Expect: &influxPoint{Measurement: "app", Tags: map[string]string{}, Fields: map[string]float64{"value": 1}, Time: now},
+		},
+		{
+			Name:   "boolean fields",
+			Line:   "app a=true,b=F",
+			Expect: &influxPoint{Measurement: "app", Tags: map[string]string{}, Fields: map[string]float64{"a": 1, "b": 0}, Time: now},
+		},
+		{Name: "string fields only", Line: `app msg="hello"`},
+		{Name: "missing fields", Line: "cpu", Err: true},
+		{Name: "too many sections", Line: "cpu value=1 1604232000 extra", Err: true},
+		{Name: "empty measurement", Line: ",host=a value=1", Err: true},
+		{Name: "invalid tag", Line: "cpu,host value=1", Err: true},
+		{Name: "empty field value", Line: "cpu value=", Err: true},
+		{Name: "unterminated string", Line: `cpu msg="hello`, Err: true},
+		{Name: "NaN value", Line: "cpu value=NaN", Err: true},
+		{Name: "infinite value", Line: "cpu value=+Inf", Err: true},
+		{Name: "invalid integer", Line: "cpu value=1.5i", Err: true},
+		{Name: "invalid timestamp", Line: "cpu value=1 yesterday", Err: true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			precision := tc.Precision
+			if precision == 0 {
+				precision = time.Nanosecond
+			}
+
+			p, err := parseInfluxLine(tc.Line, precision, now)
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("Expected error for line %q, got %#v", tc.Line, p)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(p, tc.Expect) {
+				t.Errorf("Unexpected point: %#v != %#v", p, tc.Expect)
+			}
+		})
+	}
+}
+
+func TestParseInfluxLines(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	points, err := parseInfluxLines(strings.NewReader("# comment\n\ncpu value=1\napp msg=\"hi\"\nmem value=2\n"), time.Nanosecond, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(points) != 2 || points[0].Measurement != "cpu" || points[1].Measurement != "mem" {
+		t.Errorf("Unexpected points: %#v", points)
+	}
+
+	if points, err = parseInfluxLines(strings.NewReader(""), time.Nanosecond, now); err != nil || len(points) != 0 {
+		t.Errorf("Expected no points for empty body, got %#v (%v)", points, err)
+	}
+
+	if _, err = parseInfluxLines(strings.NewReader("cpu value=1\ncpu value=x\n"), time.Nanosecond, now); err == nil || !strings.Contains(err.Error(), "Line 2") {
+		t.Errorf("Expected error for line 2, got %v", err)
+	}
+
+	// Lines exceeding the scanner buffer must fail instead of being truncated
+	if _, err = parseInfluxLines(strings.NewReader("cpu value=1,"+strings.Repeat("a", 70*1024)+"=1\n"), time.Nanosecond, now); err == nil {
+		t.Error("Expected error for oversized line")
+	}
+}
+
+func TestInfluxPointMetricID(t *testing.T) {
+	p := influxPoint{Measurement: "disk/io", Tags: map[string]string{"region": "eu", "host": "web01"}}
+	if id := p.MetricID(); id != "disk_io.web01.eu" {
+		t.Errorf("Unexpected metric ID %q", id)
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 
 	httphelper "github.com/Luzifer/go_helpers/v2/http"
+	"github.com/Luzifer/go_helpers/v2/str"
 	"github.com/Luzifer/mondash/storage"
 	"github.com/Luzifer/rconfig/v2"
 )
@@ -23,11 +26,39 @@ var (
 		FrontendDir string `flag:"frontend-dir" default:"./frontend" description:"Directory to serve frontend assets from"`
 		Storage     string `flag:"storage" default:"file:///data" description:"Storage engine to use"`
 
+		BadgeCacheTime   time.Duration `flag:"badge-cache-time" default:"1m" description:"How long clients may cache status badges"`
+		FeedLookback     time.Duration `flag:"feed-lookback" default:"24h" description:"Default time range to list status changes for in the Atom feed"`
+		RetentionTiers   []string      `flag:"retention-tiers" default:"" description:"Roll up history older than the metric freshness into buckets (resolution:retention, e.g. 5m:48h,1h:720h)"`
+		TimestampMaxSkew time.Duration `flag:"timestamp-max-skew" default:"5m" description:"How far in the future timestamps of submitted values may be"`
+		StatusCodes      []string      `flag:"status-codes" default:"OK=200,Warning=200,Critical=503,Unknown=503" description:"HTTP status codes to answer the dashboard status endpoint with (status=code)"`
+
+		GraphiteListen   string   `flag:"graphite-listen" default:"" description:"Address to listen on for Graphite plaintext metrics (TCP, disabled when empty)"`
+		GraphitePrefixes []string `flag:"graphite-prefixes" default:"" description:"Path prefixes to accept Graphite metrics for and their dashboard and token (prefix=dashid:token)"`
+
+		MaxDashboardSize int  `flag:"max-dashboard-size" default:"0" description:"Maximum size of a serialized dashboard in bytes (0 to disable)"`
+		MaxHistoryPoints int  `flag:"max-history-points" default:"0" description:"Maximum number of history points (including rollups) per metric (0 to disable)"`
+		MaxMetrics       int  `flag:"max-metrics" default:"0" description:"Maximum number of metrics per dashboard (0 to disable)"`
+		QuotaEvict       bool `flag:"quota-evict" default:"false" description:"Remove the oldest history points instead of rejecting updates exceeding the history or size quota"`
+
+		RateLimitDashboard      float64 `flag:"rate-limit-dashboard" default:"0" description:"Write requests per second allowed per dashboard and token (0 to disable)"`
+		RateLimitDashboardBurst int     `flag:"rate-limit-dashboard-burst" default:"10" description:"Write requests allowed per dashboard and token in a burst"`
+		RateLimitIP             float64 `flag:"rate-limit-ip" default:"0" description:"Requests per second allowed per client IP (0 to disable)"`
+		RateLimitIPBurst        int     `flag:"rate-limit-ip-burst" default:"20" description:"Requests allowed per client IP in a burst"`
+		TrustForwardedFor       bool    `flag:"trust-forwarded-for" default:"false" description:"Use the X-Forwarded-For header to determine the client IP (only enable behind a proxy)"`
+
+		StatsDFlushInterval time.Duration `flag:"statsd-flush-interval" default:"10s" description:"Interval to aggregate StatsD metrics in before applying them"`
+		StatsDListen        string        `flag:"statsd-listen" default:"" description:"Address to listen on for StatsD metrics (UDP, disabled when empty)"`
+		StatsDTokens        []string      `flag:"statsd-tokens" default:"" description:"Dashboards to accept StatsD metrics for and their tokens (dashid=token)"`
+
 		Listen         string `flag:"listen" default:":3000" description:"Address to listen on"`
 		LogLevel       string `flag:"log-level" default:"info" description:"Set log level (debug, info, warning, error)"`
 		VersionAndExit bool   `flag:"version" default:"false" description:"Prints current version and exits"`
 	}{}
 
+	graphitePrefixes []graphitePrefix
+	statsdTokens     map[string]string
+	statusHTTPCodes  = map[string]int{}
+
 	version = "dev"
 )
 
@@ -43,6 +74,37 @@ func init() {
 		log.Fatalf("Invalid log level: %s", err)
 	}
 
+	for _, mapping := range cfg.StatusCodes {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || !str.StringInSlice(parts[0], metricStatusStringMapping[:metricStatusTotal]) {
+			log.Fatalf("Invalid status code mapping: %q", mapping)
+		}
+
+		code, err := strconv.Atoi(parts[1])
+		if err != nil || code < 100 || code > 599 {
+			log.Fatalf("Invalid HTTP status code in mapping: %q", mapping)
+		}
+
+		statusHTTPCodes[parts[0]] = code
+	}
+
+	var err error
+	if retentionTiers, err = parseRetentionTiers(cfg.RetentionTiers); err != nil {
+		log.Fatalf("Invalid retention tiers: %s", err)
+	}
+
+	if graphitePrefixes, err = parseGraphitePrefixes(cfg.GraphitePrefixes); err != nil {
+		log.Fatalf("Invalid Graphite prefixes: %s", err)
+	}
+
+	if statsdTokens, err = parseDashboardTokens(cfg.StatsDTokens); err != nil {
+		log.Fatalf("Invalid StatsD tokens: %s", err)
+	}
+
+	if cfg.StatsDFlushInterval <= 0 {
+		log.Fatalf("StatsD flush interval must be positive")
+	}
+
 	if cfg.VersionAndExit {
 		fmt.Printf("share %s\n", version)
 		os.Exit(0)
@@ -56,11 +118,20 @@ func main() {
 		log.WithError(err).Fatal("Unable to load storage handler")
 	}
 
+	var ipLimit, dashboardLimit *rateLimiter
+	if cfg.RateLimitIP > 0 {
+		ipLimit = newRateLimiter(cfg.RateLimitIP, cfg.RateLimitIPBurst)
+	}
+	if cfg.RateLimitDashboard > 0 {
+		dashboardLimit = newRateLimiter(cfg.RateLimitDashboard, cfg.RateLimitDashboardBurst)
+	}
+
 	r := mux.NewRouter()
 	r.Use( // Sort: Outermost to innermost wrapper
 		httphelper.NewHTTPLogHandler,
 		httphelper.GzipHandler,
 		genericHeader,
+		rateLimitHandler(ipLimit, dashboardLimit, cfg.TrustForwardedFor),
 	)
 
 	r.HandleFunc("/", handleRedirectWelcome).
@@ -75,9 +146,55 @@ func main() {
 	r.HandleFunc("/{dashid}", handleDisplayDashboard).
 		Methods(http.MethodGet)
 
+	r.HandleFunc("/{dashid}/status", handleDashboardStatus).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/{dashid}/badge.svg", handleDashboardBadge).
+		Methods(http.MethodGet)
+	r.HandleFunc("/{dashid}/{metricid}/badge.svg", handleMetricBadge).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/{dashid}/feed.atom", handleStatusFeed).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/{dashid}/{metricid}/history", handleMetricHistory).
+		Methods(http.MethodGet)
+	r.HandleFunc("/{dashid}/{metricid}/sla", handleMetricSLA).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/{dashid}/write", handleInfluxWrite).
+		Methods(http.MethodPost)
+	r.HandleFunc("/{dashid}/metrics/job/{grouping:.+}", handlePushgateway).
+		Methods(http.MethodPut, http.MethodPost, http.MethodDelete)
+	r.HandleFunc("/{dashid}/alertmanager", handleAlertmanagerWebhook).
+		Methods(http.MethodPost)
+	r.HandleFunc("/{dashid}/check-result", handleCheckResult).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/{dashid}/maintenance", handleListMaintenance).
+		Methods(http.MethodGet)
+	r.HandleFunc("/{dashid}/maintenance/{windowid}", handlePutMaintenance).
+		Methods(http.MethodPut)
+	r.HandleFunc("/{dashid}/maintenance/{windowid}", handleDeleteMaintenance).
+		Methods(http.MethodDelete)
+
+	r.HandleFunc("/{dashid}/{metricid}", handleDisplayMetricJSON).
+		Methods(http.MethodGet)
 	r.HandleFunc("/{dashid}/{metricid}", handlePutMetric).
 		Methods(http.MethodPut)
 
+	r.HandleFunc("/{dashid}/{metricid}/ping", handleHeartbeat(heartbeatEventPing)).
+		Methods(http.MethodGet, http.MethodPost)
+	r.HandleFunc("/{dashid}/{metricid}/start", handleHeartbeat(heartbeatEventStart)).
+		Methods(http.MethodGet, http.MethodPost)
+	r.HandleFunc("/{dashid}/{metricid}/fail", handleHeartbeat(heartbeatEventFail)).
+		Methods(http.MethodGet, http.MethodPost)
+
+	r.HandleFunc("/{dashid}/{metricid}/ack", handleAcknowledgeMetric).
+		Methods(http.MethodPut)
+	r.HandleFunc("/{dashid}/{metricid}/ack", handleRemoveAcknowledgement).
+		Methods(http.MethodDelete)
+
 	r.HandleFunc("/{dashid}", handleDeleteDashboard).
 		Methods(http.MethodDelete)
 	r.HandleFunc("/{dashid}/{metricid}", handleDeleteMetric).
@@ -85,6 +202,22 @@ func main() {
 
 	go runWelcomePage()
 
+	if cfg.GraphiteListen != "" {
+		go func() {
+			if err := (graphiteListener{prefixes: graphitePrefixes}).Listen(cfg.GraphiteListen); err != nil {
+				log.WithError(err).Fatal("Graphite listener ended unexpectedly")
+			}
+		}()
+	}
+
+	if cfg.StatsDListen != "" {
+		go func() {
+			if err := newStatsdListener(statsdTokens).Listen(cfg.StatsDListen, cfg.StatsDFlushInterval); err != nil {
+				log.WithError(err).Fatal("StatsD listener ended unexpectedly")
+			}
+		}()
+	}
+
 	if err := http.ListenAndServe(cfg.Listen, r); err != nil {
 		log.WithError(err).Fatal("HTTP server ended unexpectedly")
 	}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"path"
+	"time"
+)
+
+const maxMaintenanceWindows = 100
+
+var maintenanceRecurrences = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// maintenanceWindow describes a (recurring) time range in which the
+// matching metrics of a dashboard are not escalated. If neither metric
+// patterns nor labels are given the window matches all metrics.
+type maintenanceWindow struct {
+	ID         string            `json:"id"`
+	Label      string            `json:"label"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Recurrence string            `json:"recurrence,omitempty"`
+	Until      *time.Time        `json:"until,omitempty"`
+	Metrics    []string          `json:"metrics,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+func (mw maintenanceWindow) IsActive(now time.Time) bool {
+	if now.Before(mw.Start) || (mw.Until != nil && now.After(*mw.Until)) {
+		return false
+	}
+
+	period, ok := maintenanceRecurrences[mw.Recurrence]
+	if !ok {
+		return now.Before(mw.End)
+	}
+
+	return now.Sub(mw.Start)%period < mw.End.Sub(mw.Start)
+}
+
+// IsFinished reports whether the window will never become active again
+func (mw maintenanceWindow) IsFinished(now time.Time) bool {
+	if mw.Recurrence == "" {
+		return now.After(mw.End)
+	}
+
+	return mw.Until != nil && now.After(*mw.Until)
+}
+
+func (mw maintenanceWindow) Matches(m *dashboardMetric) bool {
+	if len(mw.Metrics) > 0 {
+		var matched bool
+		for _, pattern := range mw.Metrics {
+			if ok, _ := path.Match(pattern, m.MetricID); ok {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	for k, v := range mw.Labels {
+		if m.Labels[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (mw maintenanceWindow) IsValid() (bool, string) {
+	if !mw.End.After(mw.Start) {
+		return false, "End must be after Start"
+	}
+
+	if period, ok := maintenanceRecurrences[mw.Recurrence]; ok {
+		if mw.End.Sub(mw.Start) >= period {
+			return false, "Window must be shorter than its recurrence"
+		}
+	} else if mw.Recurrence != "" {
+		return false, "Recurrence not allowed"
+	}
+
+	for _, pattern := range mw.Metrics {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return false, "Metric pattern invalid"
+		}
+	}
+
+	if len(mw.Label) > 512 || len(mw.Metrics) > 100 || len(mw.Labels) > 32 {
+		return false, "Label too long or too many matchers"
+	}
+
+	return true, ""
+}
+
+// applyMaintenance marks all metrics matched by an active maintenance
+// window as being in maintenance
+func (d *dashboard) applyMaintenance(now time.Time) {
+	for _, m := range d.Metrics {
+		m.maintenance = nil
+
+		for _, mw := range d.Maintenance {
+			if mw.IsActive(now) && mw.Matches(m) {
+				m.maintenance = mw
+				break
+			}
+		}
+	}
+}
+
+func (d *dashboard) removeFinishedMaintenance(now time.Time) {
+	tmp := []*maintenanceWindow{}
+	for _, mw := range d.Maintenance {
+		if !mw.IsFinished(now) {
+			tmp = append(tmp, mw)
+		}
+	}
+	d.Maintenance = tmp
+}
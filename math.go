@@ -20,6 +20,11 @@ func absoluteDeviation(values []float64) []float64 {
 func median(values []float64) float64 {
 	sort.Float64s(values)
 
+	// Counters do not record a point for their first reading
+	if len(values) == 0 {
+		return 0
+	}
+
 	if len(values) == 1 {
 		return values[0]
 	}
@@ -31,3 +36,34 @@ func median(values []float64) float64 {
 
 	return values[len(values)/2-1]
 }
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
+
+// percentile returns the p-th percentile (0 <= p <= 100) of the values
+// using linear interpolation between the closest ranks
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	pushgatewayGroupLabel = "__group__"
+	pushgatewayJobLabel   = "job"
+	pushgatewayNameLabel  = "__name__"
+)
+
+type exposedSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	Time   time.Time
+}
+
+// parseGroupingKey parses the grouping key of a Pushgateway URL path
+// (job/<job>/<label>/<value>/...) supporting base64 encoded values
+// using the "@base64" suffix on the label name
+func parseGroupingKey(path string) (map[string]string, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts)%2 != 0 {
+		return nil, errors.New("Grouping key must consist of label / value pairs")
+	}
+
+	group := map[string]string{}
+	for i := 0; i < len(parts); i += 2 {
+		name, value := parts[i], parts[i+1]
+
+		if strings.HasSuffix(name, "@base64") {
+			name = strings.TrimSuffix(name, "@base64")
+			dec, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid base64 value for label %q", name)
+			}
+			value = string(dec)
+		}
+
+		if name == "" {
+			return nil, errors.New("Empty label name in grouping key")
+		}
+
+		group[name] = value
+	}
+
+	if group[pushgatewayJobLabel] == "" {
+		return nil, errors.New("Job must not be empty")
+	}
+
+	return group, nil
+}
+
+// parseExposition parses the Prometheus text exposition format. Samples
+// of histograms and summaries are reduced to their sum and count,
+// samples with non-finite values are skipped.
+func parseExposition(body io.Reader, now time.Time) ([]exposedSample, error) {
+	var (
+		samples = []exposedSample{}
+		scanner = bufio.NewScanner(body)
+		types   = map[string]string{}
+		lineNo  int
+	)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			if fields := strings.Fields(line); len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		s, err := parseExpositionLine(line, now)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Line %d", lineNo)
+		}
+
+		for _, suffix := range []string{"_bucket", "_sum", "_count", ""} {
+			t, ok := types[strings.TrimSuffix(s.Name, suffix)]
+			if !ok || (t != "histogram" && t != "summary") {
+				continue
+			}
+
+			if suffix == "_bucket" || suffix == "" {
+				// Buckets and quantiles are not stored as metrics
+				s = nil
+			}
+			break
+		}
+
+		// Non-finite values are valid in the exposition format (summaries
+		// without observations) but can not be stored
+		if s != nil && !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+			samples = append(samples, *s)
+		}
+	}
+
+	return samples, errors.Wrap(scanner.Err(), "Unable to read body")
+}
+
+// parseExpositionLine parses a single sample line:
+// name{label="value",...} value [timestamp]
+func parseExpositionLine(line string, now time.Time) (*exposedSample, error) {
+	s := &exposedSample{Labels: map[string]string{}, Time: now}
+
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return nil, errors.New("Line does not match name value")
+	}
+	s.Name, line = line[:nameEnd], line[nameEnd:]
+
+	if strings.HasPrefix(line, "{") {
+		rest, err := parseExpositionLabels(line[1:], s.Labels)
+		if err != nil {
+			return nil, err
+		}
+		line = rest
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, errors.New("Line does not match name value timestamp")
+	}
+
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid value")
+	}
+	s.Value = v
+
+	if len(fields) == 2 {
+		ts, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid timestamp")
+		}
+		s.Time = time.Unix(0, ts*int64(time.Millisecond))
+	}
+
+	return s, nil
+}
+
+// parseExpositionLabels reads label="value" pairs into the map until the
+// closing brace and returns the remainder of the line
+func parseExpositionLabels(line string, labels map[string]string) (string, error) {
+	for {
+		line = strings.TrimLeft(line, " \t,")
+		if strings.HasPrefix(line, "}") {
+			return line[1:], nil
+		}
+
+		eq := strings.Index(line, "=")
+		if eq <= 0 || len(line) < eq+2 || line[eq+1] != '"' {
+			return "", errors.New("Invalid label")
+		}
+
+		var (
+			name    = strings.TrimSpace(line[:eq])
+			value   strings.Builder
+			escaped bool
+			end     = -1
+		)
+
+		for i := eq + 2; i < len(line) && end < 0; i++ {
+			switch {
+			case escaped && line[i] == 'n':
+				value.WriteByte('\n')
+				escaped = false
+			case escaped:
+				value.WriteByte(line[i])
+				escaped = false
+			case line[i] == '\\':
+				escaped = true
+			case line[i] == '"':
+				end = i
+			default:
+				value.WriteByte(line[i])
+			}
+		}
+
+		if end < 0 {
+			return "", errors.Errorf("Unterminated value for label %q", name)
+		}
+
+		labels[name] = value.String()
+		line = line[end+1:]
+	}
+}
+
+// groupingKeyString creates a canonical representation of the grouping
+// key stored as label to identify the metrics of a group
+func groupingKeyString(group map[string]string) string {
+	pairs := []string{}
+	for k, v := range group {
+		pairs = append(pairs, k+"="+strconv.Quote(v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// inMetricGroup checks whether the metric was pushed into the
+// Pushgateway group identified by the grouping key
+func (dm dashboardMetric) inMetricGroup(group map[string]string) bool {
+	return dm.Labels[pushgatewayGroupLabel] == groupingKeyString(group)
+}
+
+// pushgatewayMetricID builds the metric ID from the job, the values of
+// the remaining grouping labels, the sample name and the values of the
+// sample labels, each sorted by their label name
+func pushgatewayMetricID(group map[string]string, s exposedSample) string {
+	sortedValues := func(labels map[string]string) []string {
+		keys := []string{}
+		for k := range labels {
+			if k != pushgatewayJobLabel {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		values := []string{}
+		for _, k := range keys {
+			values = append(values, labels[k])
+		}
+		return values
+	}
+
+	parts := []string{group[pushgatewayJobLabel]}
+	parts = append(parts, sortedValues(group)...)
+	parts = append(parts, s.Name)
+	parts = append(parts, sortedValues(s.Labels)...)
+
+	return sanitizeMetricID(strings.Join(parts, "."))
+}
+
+// applyPushgatewaySamples stores the samples as metrics of the group.
+// When replacing the group all metrics of the group not contained in
+// the samples are removed, otherwise only metrics having the same name
+// as one of the samples are replaced.
+func (d *dashboard) applyPushgatewaySamples(group map[string]string, samples []exposedSample, replaceGroup bool) error {
+	var (
+		ids   = map[string]bool{}
+		names = map[string]bool{}
+	)
+
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+
+	for _, s := range samples {
+		metricID := pushgatewayMetricID(group, s)
+		ids[metricID] = true
+		names[s.Name] = true
+
+		labels := map[string]string{}
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		for k, v := range group {
+			// Grouping labels take precedence over sample labels
+			labels[k] = v
+		}
+		labels[pushgatewayGroupLabel] = groupingKeyString(group)
+		labels[pushgatewayNameLabel] = s.Name
+
+		update := d.metricUpdateTemplate(metricID)
+		update.Labels = labels
+		update.Status = metricStatusOK.String()
+		update.Timestamp = s.Time
+		update.Type = metricTypeGauge
+		update.Value = s.Value
+		update.Values = nil
+
+		if err := d.applyMetricUpdate(metricID, update); err != nil {
+			return errors.Wrapf(err, "Metric %q", metricID)
+		}
+	}
+
+	tmp := []*dashboardMetric{}
+	for _, m := range d.Metrics {
+		replaced := m.inMetricGroup(group) && !ids[m.MetricID] && (replaceGroup || names[m.Labels[pushgatewayNameLabel]])
+		if !replaced {
+			tmp = append(tmp, m)
+		}
+	}
+	d.Metrics = tmp
+
+	return nil
+}
+
+// deleteMetricGroup removes all metrics of the Pushgateway group
+func (d *dashboard) deleteMetricGroup(group map[string]string) {
+	tmp := []*dashboardMetric{}
+	for _, m := range d.Metrics {
+		if !m.inMetricGroup(group) {
+			tmp = append(tmp, m)
+		}
+	}
+	d.Metrics = tmp
+}
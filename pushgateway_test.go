@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExpositionLine(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		Name   string
+		Line   string
+		Expect *exposedSample
+		Err    bool
+	}{
+		{
+			Name:   "without labels",
+			Line:   "backup_size_bytes 1024",
+			Expect: &exposedSample{Name: "backup_size_bytes", Labels: map[string]string{}, Value: 1024, Time: now},
+		},
+		{
+			Name:   "with labels and timestamp",
+			Line:   `http_requests_total{method="post",code="200"} 1027 1604232000000`,
+			Expect: &exposedSample{Name: "http_requests_total", Labels: map[string]string{"method": "post", "code": "200"}, Value: 1027, Time: time.Unix(1604232000, 0)},
+		},
+		{
+			Name:   "escaped label values",
+			Line:   `msdos_file_access{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9`,
+			Expect: &exposedSample{Name: "msdos_file_access", Labels: map[string]string{"path": `C:\DIR\FILE.TXT`, "error": "Cannot find file:\n\"FILE.TXT\""}, Value: 1.458255915e9, Time: now},
+		},
+		{
+			Name:   "separators inside label value",
+			Line:   `m{a="x}, b=\"y",b="z"} -2`,
+			Expect: &exposedSample{Name: "m", Labels: map[string]string{"a": `x}, b="y`, "b": "z"}, Value: -2, Time: now},
+		},
+		{
+			Name:   "trailing comma and whitespace",
+			Line:   "m{ a=\"1\", }\t+Inf",
+			Expect: &exposedSample{Name: "m", Labels: map[string]string{"a": "1"}, Value: math.Inf(1), Time: now},
+		},
+		{Name: "missing value", Line: "backup_size_bytes", Err: true},
+		{Name: "missing name", Line: `{a="b"} 1`, Err: true},
+		{Name: "invalid value", Line: "m one", Err: true},
+		{Name: "invalid timestamp", Line: "m 1 2020-11-01", Err: true},
+		{Name: "too many fields", Line: "m 1 1604232000000 x", Err: true},
+		{Name: "unquoted label value", Line: "m{a=b} 1", Err: true},
+		{Name: "unterminated label value", Line: `m{a="b} 1`, Err: true},
+		{Name: "unterminated labels", Line: `m{a="b" 1`, Err: true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			s, err := parseExpositionLine(tc.Line, now)
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("Expected error for line %q, got %#v", tc.Line, s)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(s, tc.Expect) {
+				t.Errorf("Unexpected sample: %#v != %#v", s, tc.Expect)
+			}
+		})
+	}
+}
+
+func TestParseExposition(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	body := strings.Join([]string{
+		"# HELP backup_size_bytes Size of the last backup",
+		"# TYPE backup_size_bytes gauge",
+		"backup_size_bytes 1024",
+		"",
+		"# TYPE rpc_duration_seconds summary",
+		`rpc_duration_seconds{quantile="0.5"} NaN`,
+		"rpc_duration_seconds_sum NaN",
+		"rpc_duration_seconds_count 0",
+		"# TYPE request_duration histogram",
+		`request_duration_bucket{le="+Inf"} 3`,
+		"request_duration_sum 1.5",
+		"request_duration_count 3",
+		"temperature NaN",
+	}, "\n")
+
+	samples, err := parseExposition(strings.NewReader(body), now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	names := []string{}
+	for _, s := range samples {
+		names = append(names, s.Name)
+	}
+
+	expect := []string{"backup_size_bytes", "rpc_duration_seconds_count", "request_duration_sum", "request_duration_count"}
+	if !reflect.DeepEqual(names, expect) {
+		t.Errorf("Unexpected samples: %v != %v", names, expect)
+	}
+
+	if samples, err = parseExposition(strings.NewReader(""), now); err != nil || len(samples) != 0 {
+		t.Errorf("Expected no samples for empty body, got %#v (%v)", samples, err)
+	}
+
+	if _, err = parseExposition(strings.NewReader("a 1\nb{c=d} 2\n"), now); err == nil || !strings.Contains(err.Error(), "Line 2") {
+		t.Errorf("Expected error for line 2, got %v", err)
+	}
+
+	// Lines exceeding the scanner buffer must fail instead of being truncated
+	if _, err = parseExposition(strings.NewReader(`m{a="`+strings.Repeat("a", 70*1024)+`"} 1`), now); err == nil {
+		t.Error("Expected error for oversized line")
+	}
+}
+
+func TestParseGroupingKey(t *testing.T) {
+	for _, tc := range []struct {
+		Path   string
+		Expect map[string]string
+		Err    bool
+	}{
+		{Path: "job/backup", Expect: map[string]string{"job": "backup"}},
+		{Path: "/job/backup/instance/db01/", Expect: map[string]string{"job": "backup", "instance": "db01"}},
+		{Path: "job/backup/path@base64/L3Zhci90bXA=", Expect: map[string]string{"job": "backup", "path": "/var/tmp"}},
+		{Path: "job/backup/path@base64/L3Zhci90bXA", Expect: map[string]string{"job": "backup", "path": "/var/tmp"}},
+		{Path: "job@base64/YmFja3Vw", Expect: map[string]string{"job": "backup"}},
+		{Path: "job/backup/instance", Err: true},
+		{Path: "job/backup/path@base64/!!!", Err: true},
+		{Path: "job/backup/@base64/YQ", Err: true},
+		{Path: "instance/db01", Err: true},
+		{Path: "job@base64/", Err: true},
+	} {
+		group, err := parseGroupingKey(tc.Path)
+		if tc.Err {
+			if err == nil {
+				t.Errorf("Expected error for path %q, got %v", tc.Path, group)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unexpected error for path %q: %s", tc.Path, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(group, tc.Expect) {
+			t.Errorf("Unexpected grouping key for path %q: %v != %v", tc.Path, group, tc.Expect)
+		}
+	}
+}
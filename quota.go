@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// quotaExceededError is returned when an update would exceed one of
+// the configured quotas and contains the exceeded quota
+type quotaExceededError string
+
+func (q quotaExceededError) Error() string { return fmt.Sprintf("Quota exceeded: %s", string(q)) }
+
+// historyPointCount returns the number of raw and rolled up points
+// stored for the metric
+func (dm dashboardMetric) historyPointCount() int {
+	return len(dm.HistoricalData) + len(dm.Rollups)
+}
+
+// checkMetricQuota verifies the update of the metric with the given ID
+// does not exceed the number of metrics per dashboard and history points
+// per metric. Expired points are pruned before counting so a metric at
+// its quota is not frozen. With eviction enabled the history quota is
+// enforced after the update by trimHistory instead.
+func (d *dashboard) checkMetricQuota(metricID string) error {
+	m := d.getMetric(metricID)
+
+	if m == nil {
+		if cfg.MaxMetrics > 0 && len(d.Metrics) >= cfg.MaxMetrics {
+			return quotaExceededError(fmt.Sprintf("Dashboard must not contain more than %d metrics", cfg.MaxMetrics))
+		}
+		return nil
+	}
+
+	if cfg.MaxHistoryPoints <= 0 || cfg.QuotaEvict {
+		return nil
+	}
+
+	m.pruneHistory(time.Now())
+	if m.historyPointCount() >= cfg.MaxHistoryPoints {
+		return quotaExceededError(fmt.Sprintf("Metric must not contain more than %d history points", cfg.MaxHistoryPoints))
+	}
+
+	return nil
+}
+
+// evictOldestPoints removes the given number of oldest history points,
+// rollups are always older than the raw points and removed first
+func (dm *dashboardMetric) evictOldestPoints(n int) {
+	sort.SliceStable(dm.Rollups, func(i, j int) bool { return dm.Rollups[i].Start.Before(dm.Rollups[j].Start) })
+
+	if r := int(math.Min(float64(n), float64(len(dm.Rollups)))); r > 0 {
+		dm.Rollups = dm.Rollups[r:]
+		n -= r
+	}
+
+	if n > 0 {
+		dm.HistoricalData = dm.HistoricalData[int(math.Min(float64(n), float64(len(dm.HistoricalData)))):]
+	}
+}
+
+// trimHistory evicts the oldest points exceeding the history quota
+func (dm *dashboardMetric) trimHistory() {
+	if cfg.MaxHistoryPoints > 0 && cfg.QuotaEvict && dm.historyPointCount() > cfg.MaxHistoryPoints {
+		dm.evictOldestPoints(dm.historyPointCount() - cfg.MaxHistoryPoints)
+	}
+}
+
+// enforceSizeQuota checks the serialized size of the dashboard. With
+// eviction enabled the oldest history points of all metrics are removed
+// until the dashboard fits the quota.
+func (d *dashboard) enforceSizeQuota() error {
+	if cfg.MaxDashboardSize <= 0 {
+		return nil
+	}
+
+	for {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return errors.Wrap(err, "Unable to marshal dashboard")
+		}
+
+		if len(data) <= cfg.MaxDashboardSize {
+			return nil
+		}
+
+		total := 0
+		for _, m := range d.Metrics {
+			total += m.historyPointCount()
+		}
+
+		if !cfg.QuotaEvict || total == 0 {
+			return quotaExceededError(fmt.Sprintf("Dashboard must not be larger than %d bytes", cfg.MaxDashboardSize))
+		}
+
+		// Estimate the number of points to remove from the average size
+		// of a point, at least one point is removed every iteration
+		excess := len(data) - cfg.MaxDashboardSize
+		d.evictOldestPoints(int(math.Ceil(float64(excess) / (float64(len(data)) / float64(total)))))
+	}
+}
+
+// evictOldestPoints removes the given number of oldest history points
+// across all metrics of the dashboard
+func (d *dashboard) evictOldestPoints(n int) {
+	type pointRef struct {
+		Metric *dashboardMetric
+		Time   time.Time
+	}
+
+	points := []pointRef{}
+	for _, m := range d.Metrics {
+		for _, r := range m.Rollups {
+			points = append(points, pointRef{m, r.Start})
+		}
+		for _, p := range m.HistoricalData {
+			points = append(points, pointRef{m, p.Time})
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+
+	counts := map[*dashboardMetric]int{}
+	for i := 0; i < n && i < len(points); i++ {
+		counts[points[i].Metric]++
+	}
+
+	for m, c := range counts {
+		m.evictOldestPoints(c)
+	}
+}
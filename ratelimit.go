@@ -0,0 +1,140 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const rateLimitCleanupInterval = time.Minute
+
+type tokenBucket struct {
+	Tokens float64
+	Last   time.Time
+}
+
+// rateLimiter implements token buckets per key refilled with the given
+// rate (tokens per second) up to the burst size
+type rateLimiter struct {
+	burst float64
+	rate  float64
+
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+	lock        sync.Mutex
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		burst:   float64(burst),
+		rate:    rate,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Allow takes a token from the bucket of the key and returns whether
+// the request is allowed. If not the time until the next token is
+// available is returned.
+func (l *rateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if now.Sub(l.lastCleanup) > rateLimitCleanupInterval {
+		l.cleanup(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{Tokens: l.burst, Last: now}
+		l.buckets[key] = b
+	}
+
+	b.Tokens = math.Min(l.burst, b.Tokens+now.Sub(b.Last).Seconds()*l.rate)
+	b.Last = now
+
+	if b.Tokens < 1 {
+		return false, time.Duration((1 - b.Tokens) / l.rate * float64(time.Second))
+	}
+
+	b.Tokens--
+	return true, 0
+}
+
+// cleanup removes all buckets being refilled completely as they are
+// equal to new buckets
+func (l *rateLimiter) cleanup(now time.Time) {
+	for key, b := range l.buckets {
+		if b.Tokens+now.Sub(b.Last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastCleanup = now
+}
+
+// clientIP returns the IP of the client, taken from the X-Forwarded-For
+// header if trusted
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); trustForwardedFor && fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitHandler limits all requests per client IP and requests
+// modifying a dashboard per dashboard and token so requests using an
+// invalid token do not exhaust the limit of the dashboard owner. Nil
+// limiters are not applied.
+func rateLimitHandler(ipLimit, dashboardLimit *rateLimiter, trustForwardedFor bool) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				allowed = true
+				now     = time.Now()
+				wait    time.Duration
+			)
+
+			if ipLimit != nil {
+				allowed, wait = ipLimit.Allow(clientIP(r, trustForwardedFor), now)
+			}
+
+			var (
+				checkIn = isCheckIn(r)
+				dashID  = mux.Vars(r)["dashid"]
+				token   = requestToken(r)
+				// Check-ins are accepted using GET requests too
+				isWrite = checkIn || (r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions)
+			)
+
+			if checkIn {
+				token = checkInToken(r)
+			}
+
+			if allowed && dashboardLimit != nil && dashID != "" && isWrite {
+				allowed, wait = dashboardLimit.Allow(dashID+"/"+token, now)
+			}
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// retentionTier defines the resolution history buckets are rolled up
+// into and how long those buckets are kept before they are rolled up
+// into the next tier (or dropped for the last tier)
+type retentionTier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+var retentionTiers []retentionTier
+
+func parseRetentionTiers(in []string) ([]retentionTier, error) {
+	tiers := []retentionTier{}
+
+	for _, def := range in {
+		parts := strings.SplitN(def, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("Retention tier %q is not in format resolution:retention", def)
+		}
+
+		res, err := time.ParseDuration(parts[0])
+		if err != nil || res <= 0 {
+			return nil, errors.Errorf("Retention tier %q has invalid resolution", def)
+		}
+
+		ret, err := time.ParseDuration(parts[1])
+		if err != nil || ret < res {
+			return nil, errors.Errorf("Retention tier %q has invalid retention", def)
+		}
+
+		if l := len(tiers); l > 0 && (res <= tiers[l-1].Resolution || ret <= tiers[l-1].Retention) {
+			return nil, errors.Errorf("Retention tier %q must have higher resolution and retention than the previous tier", def)
+		}
+
+		tiers = append(tiers, retentionTier{Resolution: res, Retention: ret})
+	}
+
+	return tiers, nil
+}
+
+type valueAggregate struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	Count int     `json:"count"`
+}
+
+func aggregateOf(v float64) valueAggregate {
+	return valueAggregate{Min: v, Max: v, Avg: v, Count: 1}
+}
+
+func (v valueAggregate) merge(o valueAggregate) valueAggregate {
+	if v.Count == 0 {
+		return o
+	}
+
+	return valueAggregate{
+		Min:   math.Min(v.Min, o.Min),
+		Max:   math.Max(v.Max, o.Max),
+		Avg:   (v.Avg*float64(v.Count) + o.Avg*float64(o.Count)) / float64(v.Count+o.Count),
+		Count: v.Count + o.Count,
+	}
+}
+
+type dashboardMetricRollup struct {
+	Start      time.Time      `json:"start"`
+	Resolution int64          `json:"resolution"`
+	Status     string         `json:"status"`
+	Value      valueAggregate `json:"value"`
+
+	Series map[string]valueAggregate `json:"series,omitempty"`
+}
+
+func (r dashboardMetricRollup) merge(o dashboardMetricRollup) dashboardMetricRollup {
+	if metricStatusFromString(o.Status).IsWorseThan(metricStatusFromString(r.Status)) {
+		r.Status = o.Status
+	}
+	r.Value = r.Value.merge(o.Value)
+
+	if len(o.Series) > 0 {
+		series := map[string]valueAggregate{}
+		for name, v := range r.Series {
+			series[name] = v
+		}
+		for name, v := range o.Series {
+			series[name] = series[name].merge(v)
+		}
+		r.Series = series
+	}
+
+	return r
+}
+
+// addRollup merges the rollup into the bucket of the given tier it
+// belongs to, creating the bucket if required
+func addRollup(rollups []dashboardMetricRollup, tier retentionTier, r dashboardMetricRollup) []dashboardMetricRollup {
+	r.Start = r.Start.Truncate(tier.Resolution)
+	r.Resolution = int64(tier.Resolution / time.Second)
+
+	for i := range rollups {
+		if rollups[i].Resolution == r.Resolution && rollups[i].Start.Equal(r.Start) {
+			rollups[i] = rollups[i].merge(r)
+			return rollups
+		}
+	}
+
+	return append(rollups, r)
+}
+
+// rollupHistory moves all history points older than the freshness of
+// the metric into the first retention tier and afterwards moves the
+// buckets exceeding the retention of their tier into the next tier
+func (dm *dashboardMetric) rollupHistory(now time.Time) {
+	if len(retentionTiers) == 0 {
+		return
+	}
+
+	var (
+		rawUntil = now.Add(-time.Duration(dm.Freshness) * time.Second)
+		raw      = []dashboardMetricStatus{}
+	)
+
+	for _, p := range dm.HistoricalData {
+		if !p.Time.Before(rawUntil) {
+			raw = append(raw, p)
+			continue
+		}
+
+		series := map[string]valueAggregate{}
+		for name, v := range p.Values {
+			series[name] = aggregateOf(v)
+		}
+
+		dm.Rollups = addRollup(dm.Rollups, retentionTiers[0], dashboardMetricRollup{
+			Start:  p.Time,
+			Status: p.Status,
+			Value:  aggregateOf(p.Value),
+			Series: series,
+		})
+	}
+	dm.HistoricalData = raw
+
+	for i, tier := range retentionTiers {
+		var (
+			res     = int64(tier.Resolution / time.Second)
+			until   = now.Add(-tier.Retention)
+			rollups = []dashboardMetricRollup{}
+			moved   = []dashboardMetricRollup{}
+		)
+
+		for _, r := range dm.Rollups {
+			if r.Resolution != res || !r.Start.Add(time.Duration(r.Resolution)*time.Second).Before(until) {
+				rollups = append(rollups, r)
+				continue
+			}
+
+			if i+1 < len(retentionTiers) {
+				moved = append(moved, r)
+			}
+		}
+
+		for _, r := range moved {
+			rollups = addRollup(rollups, retentionTiers[i+1], r)
+		}
+
+		dm.Rollups = rollups
+	}
+
+	// Drop buckets of tiers no longer configured after the longest retention
+	var (
+		until   = now.Add(-retentionTiers[len(retentionTiers)-1].Retention)
+		rollups = []dashboardMetricRollup{}
+	)
+	for _, r := range dm.Rollups {
+		if r.Start.After(until) {
+			rollups = append(rollups, r)
+		}
+	}
+
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Start.Before(rollups[j].Start) })
+	dm.Rollups = rollups
+}
+
+type historyPoint struct {
+	dashboardMetricStatus
+	Duration time.Duration // Time span covered by a rolled up point
+	Weight   int
+}
+
+// fullHistory combines the rolled up buckets (using their average value
+// and worst status) and the raw history points, oldest first
+func (dm dashboardMetric) fullHistory() []historyPoint {
+	points := make([]historyPoint, 0, len(dm.Rollups)+len(dm.HistoricalData))
+
+	for _, r := range dm.Rollups {
+		values := map[string]float64{}
+		for name, v := range r.Series {
+			values[name] = v.Avg
+		}
+
+		points = append(points, historyPoint{
+			dashboardMetricStatus: dashboardMetricStatus{Time: r.Start, Status: r.Status, Value: r.Value.Avg, Values: values},
+			Duration:              time.Duration(r.Resolution) * time.Second,
+			Weight:                r.Value.Count,
+		})
+	}
+
+	for _, p := range dm.HistoricalData {
+		points = append(points, historyPoint{dashboardMetricStatus: p, Weight: 1})
+	}
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+
+	return points
+}
+
+// historyExportPoint is a point of the history export, rolled up buckets
+// are marked by their aggregate
+type historyExportPoint struct {
+	dashboardMetricStatus
+	Rollup *historyExportRollup `json:"rollup,omitempty"`
+}
+
+type historyExportRollup struct {
+	Resolution int64   `json:"resolution"`
+	Min        float64 `json:"min"`
+	Max        float64 `json:"max"`
+	Count      int     `json:"count"`
+}
+
+// exportHistory returns the rolled up buckets and raw points between
+// from and to (zero times are ignored), oldest first
+func (dm dashboardMetric) exportHistory(from, to time.Time) []historyExportPoint {
+	inRange := func(t time.Time) bool {
+		return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+	}
+
+	points := []historyExportPoint{}
+
+	for _, r := range dm.Rollups {
+		if !inRange(r.Start) {
+			continue
+		}
+
+		var values map[string]float64
+		if len(r.Series) > 0 {
+			values = map[string]float64{}
+			for name, v := range r.Series {
+				values[name] = v.Avg
+			}
+		}
+
+		points = append(points, historyExportPoint{
+			dashboardMetricStatus: dashboardMetricStatus{Time: r.Start, Status: r.Status, Value: r.Value.Avg, Values: values},
+			Rollup: &historyExportRollup{
+				Resolution: r.Resolution,
+				Min:        r.Value.Min,
+				Max:        r.Value.Max,
+				Count:      r.Value.Count,
+			},
+		})
+	}
+
+	for _, p := range dm.HistoricalData {
+		if inRange(p.Time) {
+			points = append(points, historyExportPoint{dashboardMetricStatus: p})
+		}
+	}
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+
+	return points
+}
+
+func (dm dashboardMetric) fullHistoryStatuses() []dashboardMetricStatus {
+	out := []dashboardMetricStatus{}
+	for _, p := range dm.fullHistory() {
+		out = append(out, p.dashboardMetricStatus)
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	maxSeries           = 32
+	maxSeriesNameLength = 64
+)
+
+// SeriesNames returns the sorted names of the named values of the metric
+func (dm dashboardMetric) SeriesNames() []string {
+	names := []string{}
+	for name := range dm.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// seriesHistory returns the history of the named value in the same
+// format as the history of the primary value
+func (dm dashboardMetric) seriesHistory(name string) []dashboardMetricStatus {
+	out := []dashboardMetricStatus{}
+	for _, p := range dm.fullHistory() {
+		if v, ok := p.Values[name]; ok {
+			out = append(out, dashboardMetricStatus{Time: p.Time, Status: p.Status, Value: v})
+		}
+	}
+	return out
+}
+
+// DetectSeries evaluates the current named value using the detector
+// configured for the metric
+func (dm dashboardMetric) DetectSeries(name string) detectorResult {
+	var (
+		baseline = dm.seriesHistory(name)
+		current  = dashboardMetricStatus{Time: dm.Meta.LastUpdate, Status: dm.Status, Value: dm.Values[name]}
+	)
+
+	// Latest point contains the current value, exclude it from baseline
+	if n := len(dm.HistoricalData); n > 0 {
+		if _, ok := dm.HistoricalData[n-1].Values[name]; ok {
+			current = baseline[len(baseline)-1]
+			baseline = baseline[:len(baseline)-1]
+		}
+	}
+
+	return anomalyDetectors[dm.DetectorName()].Evaluate(baseline, current)
+}
+
+func (dm dashboardMetric) SeriesMedianAndMultiplier(name string) (float64, float64) {
+	values := valuesOf(dm.seriesHistory(name))
+	if len(values) == 0 {
+		return dm.Values[name], 1
+	}
+
+	medianValue := median(values)
+	MAD := median(absoluteDeviation(values))
+
+	if MAD == 0 {
+		// Edge-case, causes div-by-zero
+		return medianValue, 1
+	}
+
+	return medianValue, math.Abs(dm.Values[name]-medianValue) / MAD
+}
+
+func (dm dashboardMetric) SeriesValueMap(name string) map[int64]float64 {
+	var (
+		history = dm.seriesHistory(name)
+		out     = map[int64]float64{}
+	)
+
+	start := int(math.Max(0, float64(len(history)-30)))
+	for _, v := range history[start:] {
+		out[v.Time.Unix()] = v.Value
+	}
+
+	return out
+}
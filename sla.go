@@ -0,0 +1,115 @@
+package main
+
+import (
+	"time"
+)
+
+const slaStatusStale = "Stale"
+
+var slaPeriods = []string{"24h", "7d", "30d", "month"}
+
+type slaReport struct {
+	Period       string             `json:"period"`
+	Start        time.Time          `json:"start"`
+	End          time.Time          `json:"end"`
+	Availability float64            `json:"availability"`
+	Coverage     float64            `json:"coverage"`
+	Durations    map[string]float64 `json:"durations"`
+	Percentages  map[string]float64 `json:"percentages"`
+}
+
+// slaPeriodStart returns the start of the named period ending at the
+// given time
+func slaPeriodStart(period string, now time.Time) (time.Time, bool) {
+	switch period {
+	case "24h":
+		return now.Add(-24 * time.Hour), true
+	case "7d":
+		return now.Add(-7 * 24 * time.Hour), true
+	case "30d":
+		return now.Add(-30 * 24 * time.Hour), true
+	case "month":
+		n := now.UTC()
+		return time.Date(n.Year(), n.Month(), 1, 0, 0, 0, 0, time.UTC), true
+	}
+
+	return time.Time{}, false
+}
+
+// SLA calculates the time weighted share of every status within the
+// given time range: Every point of the history defines the status until
+// the next point was recorded or the metric went stale. Time spent stale
+// is not counted as available, time without any data is not counted at
+// all and reported through the coverage.
+func (dm dashboardMetric) SLA(period string, start, end time.Time) slaReport {
+	var (
+		freshness = time.Duration(dm.Freshness) * time.Second
+		history   = dm.fullHistory()
+		durations = map[string]time.Duration{}
+		report    = slaReport{
+			Period:      period,
+			Start:       start,
+			End:         end,
+			Durations:   map[string]float64{},
+			Percentages: map[string]float64{},
+		}
+	)
+
+	addDuration := func(status string, from, to time.Time) {
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			durations[status] += to.Sub(from)
+		}
+	}
+
+	for i, p := range history {
+		until := end
+		if i+1 < len(history) {
+			until = history[i+1].Time
+		}
+
+		staleAt := p.Time.Add(p.Duration + freshness)
+		if until.After(staleAt) {
+			addDuration(p.Status, p.Time, staleAt)
+			addDuration(slaStatusStale, staleAt, until)
+			continue
+		}
+
+		addDuration(p.Status, p.Time, until)
+	}
+
+	var covered time.Duration
+	for _, d := range durations {
+		covered += d
+	}
+
+	statuses := append([]string{slaStatusStale}, metricStatusStringMapping[:metricStatusTotal]...)
+	for _, s := range statuses {
+		report.Durations[s] = durations[s].Seconds()
+		if covered > 0 {
+			report.Percentages[s] = float64(durations[s]) / float64(covered) * 100
+		}
+	}
+
+	report.Availability = report.Percentages[metricStatusOK.String()]
+	if total := end.Sub(start); total > 0 {
+		report.Coverage = float64(covered) / float64(total) * 100
+	}
+
+	return report
+}
+
+// SLAReports calculates the SLA for all known periods ending now
+func (dm dashboardMetric) SLAReports(now time.Time) []slaReport {
+	reports := []slaReport{}
+	for _, period := range slaPeriods {
+		start, _ := slaPeriodStart(period, now)
+		reports = append(reports, dm.SLA(period, start, now))
+	}
+	return reports
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/subtle"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const statsdMaxPacketSize = 65535
+
+type statsdKey struct {
+	DashboardID string
+	MetricID    string
+}
+
+type statsdGauge struct {
+	Value    float64
+	Relative bool
+}
+
+// statsdListener receives StatsD lines (token.dashid.metricid:value|type)
+// via UDP, aggregates them and applies the aggregates to the dashboards
+// on every flush. Only lines carrying the token configured for their
+// dashboard are accepted.
+type statsdListener struct {
+	tokens map[string]string
+
+	lock     sync.Mutex
+	counters map[statsdKey]float64
+	gauges   map[statsdKey]*statsdGauge
+	timers   map[statsdKey][]float64
+}
+
+func newStatsdListener(tokens map[string]string) *statsdListener {
+	s := &statsdListener{tokens: tokens}
+	s.reset()
+	return s
+}
+
+// parseDashboardTokens parses dashid=token mappings into a map
+func parseDashboardTokens(mappings []string) (map[string]string, error) {
+	tokens := map[string]string{}
+	for _, mapping := range mappings {
+		if mapping == "" {
+			continue
+		}
+
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("Invalid token mapping %q", mapping)
+		}
+
+		// Token and dashboard ID are part of the metric name
+		if strings.Contains(parts[0], ".") || strings.Contains(parts[1], ".") {
+			return nil, errors.Errorf("Token mapping %q must not contain dots", mapping)
+		}
+
+		tokens[parts[0]] = parts[1]
+	}
+
+	return tokens, nil
+}
+
+func (s *statsdListener) reset() {
+	s.counters = map[statsdKey]float64{}
+	s.gauges = map[statsdKey]*statsdGauge{}
+	s.timers = map[statsdKey][]float64{}
+}
+
+// Listen receives packets on the given UDP address and flushes the
+// aggregated metrics in the given interval
+func (s *statsdListener) Listen(addr string, interval time.Duration) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "Unable to listen for StatsD packets")
+	}
+	defer conn.Close()
+
+	go func() {
+		for tick := time.NewTicker(interval); ; <-tick.C {
+			s.flush(interval)
+		}
+	}()
+
+	buf := make([]byte, statsdMaxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return errors.Wrap(err, "Unable to read StatsD packet")
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+
+			if err := s.handleLine(line); err != nil {
+				log.WithError(err).WithField("line", line).Debug("Discarded StatsD line")
+			}
+		}
+	}
+}
+
+// handleLine parses a single StatsD line and adds it to the aggregates
+func (s *statsdListener) handleLine(line string) error {
+	nameValue := strings.SplitN(line, ":", 2)
+	if len(nameValue) != 2 {
+		return errors.New("Missing value")
+	}
+
+	nameParts := strings.SplitN(nameValue[0], ".", 3)
+	if len(nameParts) != 3 || nameParts[0] == "" || nameParts[1] == "" || nameParts[2] == "" {
+		return errors.New("Name does not match token.dashid.metricid")
+	}
+
+	key := statsdKey{DashboardID: nameParts[1], MetricID: sanitizeMetricID(nameParts[2])}
+	token, ok := s.tokens[key.DashboardID]
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(nameParts[0])) != 1 {
+		return errors.New("Invalid token for dashboard")
+	}
+
+	fields := strings.Split(nameValue[1], "|")
+	if len(fields) < 2 {
+		return errors.New("Missing metric type")
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return errors.Wrap(err, "Invalid value")
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return errors.New("Value is not a number")
+	}
+
+	sampleRate := 1.0
+	for _, f := range fields[2:] {
+		if !strings.HasPrefix(f, "@") {
+			continue
+		}
+		if sampleRate, err = strconv.ParseFloat(f[1:], 64); err != nil || sampleRate <= 0 || sampleRate > 1 {
+			return errors.New("Invalid sample rate")
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch fields[1] {
+	case "c":
+		s.counters[key] += value / sampleRate
+
+	case "g":
+		// Signed values modify the current gauge
+		relative := strings.HasPrefix(fields[0], "+") || strings.HasPrefix(fields[0], "-")
+		g, ok := s.gauges[key]
+		switch {
+		case !ok:
+			s.gauges[key] = &statsdGauge{Value: value, Relative: relative}
+		case relative:
+			g.Value += value
+		default:
+			g.Value, g.Relative = value, false
+		}
+
+	case "ms", "h":
+		s.timers[key] = append(s.timers[key], value)
+
+	default:
+		return errors.Errorf("Unsupported metric type %q", fields[1])
+	}
+
+	return nil
+}
+
+// flush applies the aggregated metrics collected since the last flush
+// to the dashboards: Counters are submitted as per-second rate, gauges
+// with their last value and timers with their mean and their minimum,
+// maximum and 90th percentile as named values.
+func (s *statsdListener) flush(interval time.Duration) {
+	s.lock.Lock()
+	var (
+		counters = s.counters
+		gauges   = s.gauges
+		timers   = s.timers
+	)
+	s.reset()
+	s.lock.Unlock()
+
+	updates := map[string]map[string]func(*dashboardMetric){}
+	addUpdate := func(key statsdKey, fn func(*dashboardMetric)) {
+		if updates[key.DashboardID] == nil {
+			updates[key.DashboardID] = map[string]func(*dashboardMetric){}
+		}
+		updates[key.DashboardID][key.MetricID] = fn
+	}
+
+	for key, count := range counters {
+		rate := count / interval.Seconds()
+		addUpdate(key, func(m *dashboardMetric) { m.Value = rate })
+	}
+
+	for key, g := range gauges {
+		g := g
+		addUpdate(key, func(m *dashboardMetric) {
+			if g.Relative {
+				m.Value += g.Value
+				return
+			}
+			m.Value = g.Value
+		})
+	}
+
+	for key, values := range timers {
+		values := values
+		addUpdate(key, func(m *dashboardMetric) {
+			m.Value = mean(values)
+			m.Values = map[string]float64{
+				"min": percentile(values, 0),
+				"max": percentile(values, 100),
+				"p90": percentile(values, 90),
+			}
+		})
+	}
+
+	for dashID, metrics := range updates {
+		if err := s.applyUpdates(dashID, metrics); err != nil {
+			log.WithError(err).WithField("dashboard_id", dashID).Error("Unable to apply StatsD metrics")
+		}
+	}
+}
+
+func (s *statsdListener) applyUpdates(dashID string, metrics map[string]func(*dashboardMetric)) error {
+	return updateStoredDashboard(dashID, s.tokens[dashID], store, func(dash *dashboard) error {
+		for metricID, fn := range metrics {
+			update := dash.metricUpdateTemplate(metricID)
+			update.Type = metricTypeGauge
+			update.Status = metricStatusOK.String()
+			update.Values = nil
+			fn(update)
+
+			if err := dash.applyMetricUpdate(metricID, update); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"dashboard_id": dashID,
+					"metric_id":    metricID,
+				}).Error("Unable to apply StatsD metric")
+			}
+		}
+
+		return nil
+	})
+}
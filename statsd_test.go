@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatsdHandleLine(t *testing.T) {
+	key := statsdKey{DashboardID: "dash", MetricID: "requests"}
+
+	for _, tc := range []struct {
+		Name     string
+		Lines    []string
+		Counters map[statsdKey]float64
+		Gauges   map[statsdKey]*statsdGauge
+		Timers   map[statsdKey][]float64
+		Err      bool
+	}{
+		{
+			Name:     "counters are summed",
+			Lines:    []string{"secret.dash.requests:1|c", "secret.dash.requests:2|c"},
+			Counters: map[statsdKey]float64{key: 3},
+		},
+		{
+			Name:     "counter with sample rate",
+			Lines:    []string{"secret.dash.requests:1|c|@0.1"},
+			Counters: map[statsdKey]float64{key: 10},
+		},
+		{
+			Name:   "absolute gauge replaces value",
+			Lines:  []string{"secret.dash.requests:5|g", "secret.dash.requests:7|g"},
+			Gauges: map[statsdKey]*statsdGauge{key: {Value: 7}},
+		},
+		{
+			Name:   "signed gauges modify value",
+			Lines:  []string{"secret.dash.requests:5|g", "secret.dash.requests:-2|g", "secret.dash.requests:+1|g"},
+			Gauges: map[statsdKey]*statsdGauge{key: {Value: 4}},
+		},
+		{
+			Name:   "relative gauge without absolute value",
+			Lines:  []string{"secret.dash.requests:-2|g"},
+			Gauges: map[statsdKey]*statsdGauge{key: {Value: -2, Relative: true}},
+		},
+		{
+			Name:   "timers and histograms are collected",
+			Lines:  []string{"secret.dash.requests:320|ms", "secret.dash.requests:12.5|h|#tag:value"},
+			Timers: map[statsdKey][]float64{key: {320, 12.5}},
+		},
+		{
+			Name:     "dots and slashes in metric ID",
+			Lines:    []string{"secret.dash.api.v1/users:1|c"},
+			Counters: map[statsdKey]float64{{DashboardID: "dash", MetricID: "api.v1_users"}: 1},
+		},
+		{Name: "empty line", Lines: []string{""}, Err: true},
+		{Name: "missing value", Lines: []string{"secret.dash.requests"}, Err: true},
+		{Name: "missing token", Lines: []string{"dash.requests:1|c"}, Err: true},
+		{Name: "empty metric ID", Lines: []string{"secret.dash.:1|c"}, Err: true},
+		{Name: "wrong token", Lines: []string{"guess.dash.requests:1|c"}, Err: true},
+		{Name: "unknown dashboard", Lines: []string{"secret.other.requests:1|c"}, Err: true},
+		{Name: "missing type", Lines: []string{"secret.dash.requests:1"}, Err: true},
+		{Name: "invalid value", Lines: []string{"secret.dash.requests:one|c"}, Err: true},
+		{Name: "NaN value", Lines: []string{"secret.dash.requests:NaN|g"}, Err: true},
+		{Name: "infinite value", Lines: []string{"secret.dash.requests:-Inf|c"}, Err: true},
+		{Name: "invalid sample rate", Lines: []string{"secret.dash.requests:1|c|@2"}, Err: true},
+		{Name: "zero sample rate", Lines: []string{"secret.dash.requests:1|c|@0"}, Err: true},
+		{Name: "unsupported type", Lines: []string{"secret.dash.requests:1|s"}, Err: true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := newStatsdListener(map[string]string{"dash": "secret"})
+
+			for _, line := range tc.Lines {
+				err := s.handleLine(line)
+				if tc.Err {
+					if err == nil {
+						t.Fatalf("Expected error for line %q", line)
+					}
+					return
+				}
+
+				if err != nil {
+					t.Fatalf("Unexpected error for line %q: %s", line, err)
+				}
+			}
+
+			expect := newStatsdListener(nil)
+			if tc.Counters != nil {
+				expect.counters = tc.Counters
+			}
+			if tc.Gauges != nil {
+				expect.gauges = tc.Gauges
+			}
+			if tc.Timers != nil {
+				expect.timers = tc.Timers
+			}
+
+			if !reflect.DeepEqual(s.counters, expect.counters) {
+				t.Errorf("Unexpected counters: %v != %v", s.counters, expect.counters)
+			}
+			if !reflect.DeepEqual(s.gauges, expect.gauges) {
+				t.Errorf("Unexpected gauges: %v != %v", s.gauges, expect.gauges)
+			}
+			if !reflect.DeepEqual(s.timers, expect.timers) {
+				t.Errorf("Unexpected timers: %v != %v", s.timers, expect.timers)
+			}
+		})
+	}
+}
+
+func TestParseDashboardTokens(t *testing.T) {
+	for _, tc := range []struct {
+		Mappings []string
+		Expect   map[string]string
+		Err      bool
+	}{
+		{Mappings: nil, Expect: map[string]string{}},
+		{Mappings: []string{"", "dash=secret", "other=token=with=equals"}, Expect: map[string]string{"dash": "secret", "other": "token=with=equals"}},
+		{Mappings: []string{"dash"}, Err: true},
+		{Mappings: []string{"=secret"}, Err: true},
+		{Mappings: []string{"dash="}, Err: true},
+		{Mappings: []string{"my.dash=secret"}, Err: true},
+		{Mappings: []string{"dash=sec.ret"}, Err: true},
+	} {
+		tokens, err := parseDashboardTokens(tc.Mappings)
+		if tc.Err {
+			if err == nil {
+				t.Errorf("Expected error for mappings %v", tc.Mappings)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unexpected error for mappings %v: %s", tc.Mappings, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(tokens, tc.Expect) {
+			t.Errorf("Unexpected tokens: %v != %v", tokens, tc.Expect)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,7 +18,17 @@ import (
 
 const defaultStalenessStatus = metricStatusUnknown
 
-var errDashboardNotFound = errors.New("Dashboard not found")
+var (
+	errDashboardNotFound = errors.New("Dashboard not found")
+	errAPIKeyInsecure    = errors.New("APIKey is too insecure")
+	errAPIKeyMismatch    = errors.New("APIKey did not match.")
+)
+
+// invalidDataError is returned when a metric update did not pass the
+// validation and contains the reason
+type invalidDataError string
+
+func (i invalidDataError) Error() string { return fmt.Sprintf("Invalid data: %s", string(i)) }
 
 // --- Metric Status ---
 
@@ -38,6 +51,14 @@ const (
 	metricStatusTotal // Only internally used
 )
 
+// metricStatusSeverity ranks the states from best to worst
+var metricStatusSeverity = map[metricStatus]int{
+	metricStatusOK:       0,
+	metricStatusUnknown:  1,
+	metricStatusWarning:  2,
+	metricStatusCritical: 3,
+}
+
 func metricStatusFromString(in string) metricStatus {
 	for i, v := range metricStatusStringMapping {
 		if v == in {
@@ -52,12 +73,17 @@ func (m metricStatus) String() string {
 	return metricStatusStringMapping[m]
 }
 
+func (m metricStatus) IsWorseThan(o metricStatus) bool {
+	return metricStatusSeverity[m] > metricStatusSeverity[o]
+}
+
 // --- Dashboard ---
 
 type dashboard struct {
-	DashboardID string             `json:"-"`
-	APIKey      string             `json:"api_key"`
-	Metrics     []*dashboardMetric `json:"metrics"`
+	DashboardID string               `json:"-"`
+	APIKey      string               `json:"api_key"`
+	Metrics     []*dashboardMetric   `json:"metrics"`
+	Maintenance []*maintenanceWindow `json:"maintenance,omitempty"`
 
 	storage storage.Storage
 }
@@ -78,10 +104,178 @@ func loadDashboard(dashid string, store storage.Storage) (*dashboard, error) {
 	}
 
 	tmp.migrate() // Do a load-migration, it will be applied on save
+	tmp.applyMaintenance(time.Now())
 
 	return tmp, nil
 }
 
+// loadOrCreateDashboard loads the dashboard and checks the token against
+// its APIKey. If the dashboard does not exist yet it is created with the
+// token as APIKey.
+func loadOrCreateDashboard(dashid, token string, store storage.Storage) (*dashboard, error) {
+	dash, err := loadDashboard(dashid, store)
+	switch err {
+	case nil:
+		// All fine
+
+	case errDashboardNotFound:
+		// Dashboard may be created with first metrics put
+		if len(token) < 10 {
+			return nil, errAPIKeyInsecure
+		}
+
+		dash = &dashboard{
+			APIKey:      token,
+			Metrics:     []*dashboardMetric{},
+			DashboardID: dashid,
+			storage:     store,
+		}
+
+	default:
+		return nil, err
+	}
+
+	if dash.APIKey != token {
+		return nil, errAPIKeyMismatch
+	}
+
+	return dash, nil
+}
+
+// updateStoredDashboard loads the dashboard (creating it if required),
+// applies the changes, enforces the size quota and saves the dashboard.
+// All ingestion paths must use this to have the quotas enforced.
+func updateStoredDashboard(dashid, token string, store storage.Storage, apply func(*dashboard) error) error {
+	dash, err := loadOrCreateDashboard(dashid, token, store)
+	if err != nil {
+		return err
+	}
+
+	if err := apply(dash); err != nil {
+		return err
+	}
+
+	if err := dash.enforceSizeQuota(); err != nil {
+		return err
+	}
+
+	return errors.Wrap(dash.Save(), "Unable to save dashboard")
+}
+
+// sanitizeMetricID replaces characters in metric IDs built from
+// submitted data which can not be used in the metric URL
+func sanitizeMetricID(id string) string {
+	return strings.Replace(id, "/", "_", -1)
+}
+
+// reservedMetricIDs collide with the dashboard endpoints: Metrics using
+// them could be written but not be read or acknowledged
+var reservedMetricIDs = []string{"alertmanager", "badge.svg", "check-result", "feed.atom", "maintenance", "status", "write"}
+
+func validateMetricID(metricID string) error {
+	if str.StringInSlice(metricID, reservedMetricIDs) {
+		return invalidDataError(fmt.Sprintf("Metric ID %q is reserved", metricID))
+	}
+	return nil
+}
+
+// applyMetricUpdate validates the update and applies it to the metric
+// with the given ID, creating the metric if it does not exist yet
+func (d *dashboard) applyMetricUpdate(metricID string, update *dashboardMetric) error {
+	if err := validateMetricID(metricID); err != nil {
+		return err
+	}
+
+	if valid, reason := update.IsValid(); !valid {
+		return invalidDataError(reason)
+	}
+
+	if err := d.checkMetricQuota(metricID); err != nil {
+		return err
+	}
+
+	m := d.getMetric(metricID)
+	if m == nil {
+		m = newDashboardMetric()
+		m.MetricID = metricID
+		d.Metrics = append(d.Metrics, m)
+	}
+
+	m.Update(update)
+	m.trimHistory()
+	return nil
+}
+
+// metricUpdateTemplate returns an update for the metric with the given
+// ID carrying its current configuration so ingestion paths not
+// submitting a full metric definition do not reset it
+func (d *dashboard) metricUpdateTemplate(metricID string) *dashboardMetric {
+	if m := d.getMetric(metricID); m != nil {
+		tmp := *m
+		return &tmp
+	}
+
+	tmp := newDashboardMetric()
+	tmp.Title = metricID
+	return tmp
+}
+
+func (d *dashboard) getMetric(metricID string) *dashboardMetric {
+	for _, m := range d.Metrics {
+		if m.MetricID == metricID {
+			return m
+		}
+	}
+	return nil
+}
+
+type dashboardStatus struct {
+	Status      string         `json:"status"`
+	Counts      map[string]int `json:"counts"`
+	Metrics     int            `json:"metrics"`
+	Maintenance int            `json:"maintenance"`
+}
+
+// AggregateStatus collects the status of all non-expired metrics and
+// determines the worst status among the metrics not in maintenance
+func (d *dashboard) AggregateStatus() dashboardStatus {
+	var (
+		now    = time.Now()
+		status = dashboardStatus{Counts: map[string]int{}}
+		worst  = metricStatusOK
+	)
+
+	for _, s := range metricStatusStringMapping[:metricStatusTotal] {
+		status.Counts[s] = 0
+	}
+
+	for _, m := range d.Metrics {
+		if m.IsExpired(now) {
+			continue
+		}
+
+		ms := metricStatusFromString(m.PreferredStatus())
+		status.Counts[ms.String()]++
+		status.Metrics++
+
+		if m.InMaintenance() {
+			status.Maintenance++
+			continue
+		}
+
+		if ms.IsWorseThan(worst) {
+			worst = ms
+		}
+	}
+
+	if status.Metrics == 0 {
+		worst = metricStatusUnknown
+	}
+
+	status.Status = worst.String()
+	return status
+}
+
 func (d *dashboard) Save() error {
 	data, err := json.Marshal(d)
 	if err != nil {
@@ -108,27 +302,64 @@ func (d *dashboard) migrate() {
 
 // --- Dashboard Metric ---
 
+const (
+	metricTypeGauge     = "gauge"
+	metricTypeCounter   = "counter"
+	metricTypeHeartbeat = "heartbeat"
+)
+
+var metricTypes = []string{metricTypeGauge, metricTypeCounter, metricTypeHeartbeat}
+
 type dashboardMetric struct {
-	MetricID        string                  `json:"id"`
-	Title           string                  `json:"title"`
-	Description     string                  `json:"description"`
-	DetailURL       string                  `json:"detail_url"`
-	Status          string                  `json:"status"`
-	Value           float64                 `json:"value,omitempty"`
-	Expires         int64                   `json:"expires,omitempty"`
-	Freshness       int64                   `json:"freshness,omitempty"`
-	IgnoreMAD       bool                    `json:"ignore_mad"`
-	HideMAD         bool                    `json:"hide_mad"`
-	HideValue       bool                    `json:"hide_value"`
-	HistoricalData  []dashboardMetricStatus `json:"history,omitempty"`
-	Meta            dashboardMetricMeta     `json:"meta,omitempty"`
-	StalenessStatus string                  `json:"staleness_status,omitempty"`
+	MetricID           string                  `json:"id"`
+	Title              string                  `json:"title"`
+	Description        string                  `json:"description"`
+	DetailURL          string                  `json:"detail_url"`
+	Status             string                  `json:"status"`
+	Value              float64                 `json:"value,omitempty"`
+	Values             map[string]float64      `json:"values,omitempty"`
+	Type               string                  `json:"type,omitempty"`
+	Counter            float64                 `json:"counter,omitempty"`
+	CounterValues      map[string]float64      `json:"counter_values,omitempty"`
+	Timestamp          time.Time               `json:"-"`
+	Expires            int64                   `json:"expires,omitempty"`
+	Freshness          int64                   `json:"freshness,omitempty"`
+	Detector           string                  `json:"detector,omitempty"`
+	FlapDetection      bool                    `json:"flap_detection,omitempty"`
+	FlapWindow         int                     `json:"flap_window,omitempty"`
+	FlapThresholdLow   float64                 `json:"flap_threshold_low,omitempty"`
+	FlapThresholdHigh  float64                 `json:"flap_threshold_high,omitempty"`
+	FlapStatus         string                  `json:"flap_status,omitempty"`
+	RequireConsecutive int                     `json:"require_consecutive,omitempty"`
+	IgnoreMAD          bool                    `json:"ignore_mad"`
+	HideMAD            bool                    `json:"hide_mad"`
+	HideValue          bool                    `json:"hide_value"`
+	Unit               string                  `json:"unit,omitempty"`
+	Precision          *int                    `json:"precision,omitempty"`
+	HistoricalData     []dashboardMetricStatus `json:"history,omitempty"`
+	Rollups            []dashboardMetricRollup `json:"rollups,omitempty"`
+	StatusChanges      []statusTransition      `json:"status_changes,omitempty"`
+	Meta               dashboardMetricMeta     `json:"meta,omitempty"`
+	StalenessStatus    string                  `json:"staleness_status,omitempty"`
+	Acknowledgement    *metricAcknowledgement  `json:"acknowledgement,omitempty"`
+	Labels             map[string]string       `json:"labels,omitempty"`
+
+	maintenance *maintenanceWindow
 }
 
 type dashboardMetricStatus struct {
-	Time   time.Time `json:"time"`
-	Status string    `json:"status"`
-	Value  float64   `json:"value"`
+	Time   time.Time          `json:"time"`
+	Status string             `json:"status"`
+	Value  float64            `json:"value"`
+	Values map[string]float64 `json:"values,omitempty"`
+}
+
+type metricAcknowledgement struct {
+	Author        string    `json:"author"`
+	Comment       string    `json:"comment"`
+	ClearOnChange bool      `json:"clear_on_change"`
+	Status        string    `json:"status"`
+	Time          time.Time `json:"time"`
 }
 
 type dashboardMetricMeta struct {
@@ -138,6 +369,17 @@ type dashboardMetricMeta struct {
 	PercWarn   float64   `json:"perc_warn"`
 	PercCrit   float64   `json:"perc_crit"`
 
+	Flapping       bool    `json:"flapping"`
+	FlapPercentage float64 `json:"flap_percentage"`
+
+	RecentStatuses []string `json:"recent_statuses,omitempty"`
+
+	StableStatus  string `json:"stable_status,omitempty"`
+	PendingStatus string `json:"pending_status,omitempty"`
+	PendingCount  int    `json:"pending_count,omitempty"`
+
+	JobStart *time.Time `json:"job_start,omitempty"`
+
 	MIGLastUpdate time.Time `json:"LastUpdate,omitempty"`
 	MIGLastOK     time.Time `json:"LastOK,omitempty"`
 }
@@ -155,7 +397,7 @@ func newDashboardMetric() *dashboardMetric {
 func (dm dashboardMetric) getValueArray() []float64 {
 	values := []float64{}
 
-	for _, v := range dm.HistoricalData {
+	for _, v := range dm.fullHistory() {
 		values = append(values, v.Value)
 	}
 
@@ -184,44 +426,113 @@ func (dm dashboardMetric) MadMultiplier() float64 {
 	return math.Abs(dm.Value-medianValue) / MAD
 }
 
-func (dm dashboardMetric) StatisticalStatus() string {
-	mult := dm.MadMultiplier()
+func (dm dashboardMetric) DetectorName() string {
+	if _, ok := anomalyDetectors[dm.Detector]; ok {
+		return dm.Detector
+	}
+	return defaultDetector
+}
 
-	switch {
-	case mult > 4:
-		return metricStatusStringMapping[metricStatusCritical]
+// Detect evaluates the current value of the metric using the detector
+// configured for the metric
+func (dm dashboardMetric) Detect() detectorResult {
+	var (
+		baseline = dm.fullHistoryStatuses()
+		current  = dashboardMetricStatus{Time: dm.Meta.LastUpdate, Status: dm.Status, Value: dm.Value}
+	)
 
-	case mult > 3:
-		return metricStatusStringMapping[metricStatusWarning]
+	if len(dm.HistoricalData) > 0 {
+		current = baseline[len(baseline)-1]
+		baseline = baseline[:len(baseline)-1]
+	}
 
-	default:
-		return metricStatusStringMapping[metricStatusOK]
+	return anomalyDetectors[dm.DetectorName()].Evaluate(baseline, current)
+}
+
+// StatisticalStatus rates the primary value and all named values and
+// returns the worst status of them
+func (dm dashboardMetric) StatisticalStatus() string {
+	status := dm.Detect().Status
+
+	for _, name := range dm.SeriesNames() {
+		if s := dm.DetectSeries(name).Status; s.IsWorseThan(status) {
+			status = s
+		}
 	}
+
+	return status.String()
 }
 
 func (dm dashboardMetric) PreferredStatus() string {
+	// Metric is in maintenance, staleness is not checked and the status
+	// is not escalated beyond unknown
+	if dm.maintenance != nil {
+		if status := dm.currentStatus(); status != metricStatusOK.String() {
+			return metricStatusUnknown.String()
+		}
+		return metricStatusOK.String()
+	}
+
 	// Metric might be stale, return stale status
 	if dm.Meta.LastUpdate.Add(time.Duration(dm.Freshness) * time.Second).Before(time.Now()) {
 		if dm.StalenessStatus == "" {
+			if dm.Type == metricTypeHeartbeat {
+				// Missing check-ins are the failure signal of heartbeats
+				return metricStatusCritical.String()
+			}
 			return defaultStalenessStatus.String()
 		}
 		return dm.StalenessStatus
 	}
 
-	// If MAD is ignored use given status
-	if dm.IgnoreMAD {
-		return dm.Status
+	return dm.currentStatus()
+}
+
+func (dm dashboardMetric) currentStatus() string {
+	// Metric is flapping and a status for flapping metrics is configured
+	if dm.Meta.Flapping && dm.FlapStatus != "" {
+		return dm.FlapStatus
+	}
+
+	// Use the given or evaluated status once it was stable long enough
+	return dm.stableStatus()
+}
+
+// MetricType returns the type of the metric, defaulting to gauge
+func (dm dashboardMetric) MetricType() string {
+	if dm.Type == "" {
+		return metricTypeGauge
 	}
+	return dm.Type
+}
+
+func (dm dashboardMetric) DisplayPrecision() int {
+	if dm.Precision == nil {
+		return defaultPrecision
+	}
+	return *dm.Precision
+}
+
+func (dm dashboardMetric) FormattedValue() string {
+	return formatValue(dm.Value, dm.Unit, dm.DisplayPrecision())
+}
 
-	// By default use MAD for status
-	return dm.StatisticalStatus()
+func (dm dashboardMetric) IsExpired(now time.Time) bool {
+	return !dm.Meta.LastUpdate.After(now.Add(time.Duration(dm.Expires*-1) * time.Second))
+}
+
+func (dm dashboardMetric) InMaintenance() bool {
+	return dm.maintenance != nil
 }
 
 func (dm dashboardMetric) HistoricalValueMap() map[int64]float64 {
-	out := map[int64]float64{}
+	var (
+		history = dm.fullHistoryStatuses()
+		out     = map[int64]float64{}
+	)
 
-	start := int(math.Max(0, float64(len(dm.HistoricalData)-30)))
-	for _, v := range dm.HistoricalData[start:] {
+	start := int(math.Max(0, float64(len(history)-30)))
+	for _, v := range history[start:] {
 		out[v.Time.Unix()] = v.Value
 	}
 
@@ -259,15 +570,65 @@ func (dm dashboardMetric) DataHistory() []string {
 }
 
 func (dm *dashboardMetric) Update(m *dashboardMetric) {
-	dm.Description = m.Description
-	dm.DetailURL = m.DetailURL
+	pointTime := time.Now()
+	if !m.Timestamp.IsZero() {
+		pointTime = m.Timestamp
+	}
+
+	// Points older than the last update are only added to the history
+	// and do not change the current state of the metric
+	latest := dm.Meta.LastUpdate.IsZero() || !pointTime.Before(dm.Meta.LastUpdate)
+
+	record := true
+	switch {
+	case m.Type == metricTypeCounter && latest:
+		// Counters are evaluated by their rate instead of the raw value
+		record = dm.convertCounter(m, pointTime)
+	case m.Type == metricTypeCounter:
+		// No rate can be calculated for counter readings out of order
+		record = false
+	default:
+		dm.Counter = 0
+		dm.CounterValues = nil
+	}
+
+	dm.Detector = m.Detector
+	dm.FlapDetection = m.FlapDetection
+	dm.FlapStatus = m.FlapStatus
+	dm.FlapThresholdHigh = m.FlapThresholdHigh
+	dm.FlapThresholdLow = m.FlapThresholdLow
+	dm.FlapWindow = m.FlapWindow
 	dm.HideMAD = m.HideMAD
 	dm.HideValue = m.HideValue
+	dm.Precision = m.Precision
+	dm.Unit = m.Unit
 	dm.IgnoreMAD = m.IgnoreMAD
+	dm.Labels = m.Labels
+	dm.RequireConsecutive = m.RequireConsecutive
 	dm.StalenessStatus = m.StalenessStatus
-	dm.Status = m.Status
 	dm.Title = m.Title
-	dm.Value = m.Value
+	dm.Type = m.Type
+
+	if latest {
+		if record && !dm.Meta.LastUpdate.IsZero() && m.Status != dm.Status {
+			// Status changes are kept separately as rolling up the
+			// history merges them into buckets
+			dm.StatusChanges = append(dm.StatusChanges, statusTransition{
+				Time:  pointTime,
+				From:  dm.Status,
+				To:    m.Status,
+				Value: m.Value,
+			})
+		}
+
+		// Description and detail URL belong to the result and are not
+		// replaced by results submitted late
+		dm.Description = m.Description
+		dm.DetailURL = m.DetailURL
+		dm.Status = m.Status
+		dm.Value = m.Value
+		dm.Values = m.Values
+	}
 
 	if m.Expires != 0 {
 		dm.Expires = m.Expires
@@ -277,39 +638,92 @@ func (dm *dashboardMetric) Update(m *dashboardMetric) {
 		dm.Freshness = m.Freshness
 	}
 
-	dm.HistoricalData = append(dm.HistoricalData, dashboardMetricStatus{
-		Time:   time.Now(),
-		Status: m.Status,
-		Value:  m.Value,
-	})
+	if record {
+		idx := sort.Search(len(dm.HistoricalData), func(i int) bool { return dm.HistoricalData[i].Time.After(pointTime) })
+		dm.HistoricalData = append(dm.HistoricalData, dashboardMetricStatus{})
+		copy(dm.HistoricalData[idx+1:], dm.HistoricalData[idx:])
+		dm.HistoricalData[idx] = dashboardMetricStatus{
+			Time:   pointTime,
+			Status: m.Status,
+			Value:  m.Value,
+			Values: m.Values,
+		}
+	}
 
-	countStatus := make(map[metricStatus]float64)
+	dm.pruneHistory(time.Now())
 
-	expired := time.Now().Add(time.Duration(dm.Expires*-1) * time.Second)
+	var (
+		countStatus = make(map[metricStatus]float64)
+		expired     = time.Now().Add(time.Duration(dm.Expires*-1) * time.Second)
+	)
+
+	// Rolled up points count with the number of points they cover
+	for _, p := range dm.fullHistory() {
+		if !p.Time.After(expired) {
+			continue
+		}
+
+		statusVal := metricStatusFromString(p.Status)
+		countStatus[statusVal] = countStatus[statusVal] + float64(p.Weight)
+		countStatus[metricStatusTotal] = countStatus[metricStatusTotal] + float64(p.Weight)
+
+		if dm.Meta.LastOK.Before(p.Time) && statusVal == metricStatusOK {
+			dm.Meta.LastOK = p.Time
+		}
+	}
+
+	if latest {
+		dm.Meta.LastUpdate = pointTime
+	}
+	if countStatus[metricStatusTotal] > 0 {
+		dm.Meta.PercCrit = countStatus[metricStatusCritical] / countStatus[metricStatusTotal] * 100
+		dm.Meta.PercWarn = countStatus[metricStatusWarning] / countStatus[metricStatusTotal] * 100
+		dm.Meta.PercOK = countStatus[metricStatusOK] / countStatus[metricStatusTotal] * 100
+	}
+
+	if latest && record {
+		dm.updateEvaluatedStatus()
+	}
+
+	dm.updateFlapping()
+	dm.updateAcknowledgement()
+}
+
+// pruneHistory rolls up the history points older than the freshness and
+// removes the points older than the expiry of the metric
+func (dm *dashboardMetric) pruneHistory(now time.Time) {
+	dm.rollupHistory(now)
+
+	expired := now.Add(time.Duration(dm.Expires*-1) * time.Second)
 	tmp := []dashboardMetricStatus{}
 
 	for _, s := range dm.HistoricalData {
 		if s.Time.After(expired) {
-			statusVal := metricStatusFromString(s.Status)
-
 			tmp = append(tmp, s)
+		}
+	}
 
-			countStatus[statusVal] = countStatus[statusVal] + 1
-			countStatus[metricStatusTotal] = countStatus[metricStatusTotal] + 1
+	dm.HistoricalData = tmp
 
-			if dm.Meta.LastOK.Before(s.Time) && statusVal == metricStatusOK {
-				dm.Meta.LastOK = s.Time
-			}
+	changes := []statusTransition{}
+	for _, c := range dm.StatusChanges {
+		if c.Time.After(expired) {
+			changes = append(changes, c)
 		}
 	}
+	dm.StatusChanges = changes
+}
 
-	dm.HistoricalData = tmp
+// updateAcknowledgement removes the acknowledgement once the metric
+// returned to OK or, if requested, changed its status
+func (dm *dashboardMetric) updateAcknowledgement() {
+	if dm.Acknowledgement == nil {
+		return
+	}
 
-	dm.Meta.LastUpdate = time.Now()
-	if countStatus[metricStatusTotal] > 0 {
-		dm.Meta.PercCrit = countStatus[metricStatusCritical] / countStatus[metricStatusTotal] * 100
-		dm.Meta.PercWarn = countStatus[metricStatusWarning] / countStatus[metricStatusTotal] * 100
-		dm.Meta.PercOK = countStatus[metricStatusOK] / countStatus[metricStatusTotal] * 100
+	status := dm.PreferredStatus()
+	if status == metricStatusOK.String() || (dm.Acknowledgement.ClearOnChange && status != dm.Acknowledgement.Status) {
+		dm.Acknowledgement = nil
 	}
 }
 
@@ -318,6 +732,20 @@ func (dm dashboardMetric) IsValid() (bool, string) {
 		return false, "Expires not in range 0 < x < 640800"
 	}
 
+	if !dm.Timestamp.IsZero() {
+		if dm.Timestamp.After(time.Now().Add(cfg.TimestampMaxSkew)) {
+			return false, "Timestamp is too far in the future"
+		}
+
+		expires := dm.Expires
+		if expires == 0 {
+			expires = newDashboardMetric().Expires
+		}
+		if dm.Timestamp.Before(time.Now().Add(-time.Duration(expires) * time.Second)) {
+			return false, "Timestamp is older than the expiry of the history"
+		}
+	}
+
 	if dm.Freshness > 604800 || dm.Freshness < 0 {
 		return false, "Freshness not in range 0 < x < 640800"
 	}
@@ -326,6 +754,58 @@ func (dm dashboardMetric) IsValid() (bool, string) {
 		return false, "Status not allowed"
 	}
 
+	if dm.Type != "" && !str.StringInSlice(dm.Type, metricTypes) {
+		return false, "Type not allowed"
+	}
+
+	if _, ok := anomalyDetectors[dm.Detector]; dm.Detector != "" && !ok {
+		return false, "Detector not known"
+	}
+
+	if dm.FlapWindow > maxFlapWindow || dm.FlapWindow < 0 {
+		return false, "FlapWindow not in range 0 < x < 100"
+	}
+
+	if low, high := dm.flapThresholds(); low < 0 || high > 100 || low > high {
+		return false, "Flap thresholds not in range 0 < low < high < 100"
+	}
+
+	if dm.FlapStatus != "" && !str.StringInSlice(dm.FlapStatus, metricStatusStringMapping) {
+		return false, "FlapStatus not allowed"
+	}
+
+	if dm.RequireConsecutive > maxRequireConsecutive || dm.RequireConsecutive < 0 {
+		return false, "RequireConsecutive not in range 0 < x < 100"
+	}
+
+	if dm.Precision != nil && (*dm.Precision < 0 || *dm.Precision > maxPrecision) {
+		return false, "Precision not in range 0 < x < 10"
+	}
+
+	if len(dm.Unit) > maxUnitLength {
+		return false, "Unit too long"
+	}
+
+	if len(dm.Values) > maxSeries {
+		return false, "Too many values"
+	}
+
+	for name := range dm.Values {
+		if name == "" || len(name) > maxSeriesNameLength {
+			return false, "Value name empty or too long"
+		}
+	}
+
+	if len(dm.Labels) > 32 {
+		return false, "Too many labels"
+	}
+
+	for k, v := range dm.Labels {
+		if len(k) > 256 || len(v) > 256 {
+			return false, "Label too long"
+		}
+	}
+
 	if len(dm.Title) > 512 || len(dm.Description) > 1024 {
 		return false, "Title or Description too long"
 	}
@@ -343,16 +823,26 @@ type historyBarSegment struct {
 
 func (dm dashboardMetric) GetHistoryBar() []historyBarSegment {
 	var (
-		point     dashboardMetricStatus
-		segLength int
-		segments  = []historyBarSegment{}
-		segStart  time.Time
-		status    = defaultStalenessStatus
+		history     = dm.fullHistory()
+		point       historyPoint
+		segLength   int
+		segments    = []historyBarSegment{}
+		segStart    time.Time
+		status      = defaultStalenessStatus
+		totalWeight int
 	)
 
-	for _, point = range dm.HistoricalData {
+	for _, p := range history {
+		totalWeight += p.Weight
+	}
+
+	if totalWeight == 0 {
+		return segments
+	}
+
+	for _, point = range history {
 		if metricStatusFromString(point.Status) == status {
-			segLength++
+			segLength += point.Weight
 			continue
 		}
 
@@ -361,14 +851,14 @@ func (dm dashboardMetric) GetHistoryBar() []historyBarSegment {
 			segments = append(segments, historyBarSegment{
 				Duration:   point.Time.Sub(segStart),
 				End:        point.Time,
-				Percentage: float64(segLength) / float64(len(dm.HistoricalData)),
+				Percentage: float64(segLength) / float64(totalWeight),
 				Start:      segStart,
 				Status:     status.String(),
 			})
 		}
 
 		// Start a new segment
-		segLength = 1
+		segLength = point.Weight
 		segStart = point.Time
 		status = metricStatusFromString(point.Status)
 	}
@@ -376,7 +866,7 @@ func (dm dashboardMetric) GetHistoryBar() []historyBarSegment {
 	segments = append(segments, historyBarSegment{
 		Duration:   point.Time.Sub(segStart),
 		End:        point.Time,
-		Percentage: float64(segLength) / float64(len(dm.HistoricalData)),
+		Percentage: float64(segLength) / float64(totalWeight),
 		Start:      segStart,
 		Status:     status.String(),
 	})
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"math"
 	"mime"
 	"net/http"
 	"os"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -22,48 +30,163 @@ type output struct {
 }
 
 type outputMetricConfig struct {
-	HideMAD   bool `json:"hide_mad"`
-	HideValue bool `json:"hide_value"`
+	HideMAD   bool   `json:"hide_mad"`
+	HideValue bool   `json:"hide_value"`
+	Precision int    `json:"precision"`
+	Type      string `json:"type"`
+	Unit      string `json:"unit"`
+}
+
+type outputMetricSeries struct {
+	Detector       outputMetricDetector `json:"detector"`
+	Median         float64              `json:"median"`
+	MADMultiplier  float64              `json:"mad_multiplier"`
+	Status         string               `json:"status"`
+	Value          float64              `json:"value"`
+	ValueFormatted string               `json:"value_formatted"`
+	ValueHistory   map[int64]float64    `json:"value_history,omitempty"`
+}
+
+type outputMetricDetector struct {
+	Name string `json:"name"`
+	detectorResult
 }
 
 type outputMetric struct {
-	ID            string              `json:"id"`
-	Config        outputMetricConfig  `json:"config"`
-	Description   string              `json:"description"`
-	DetailURL     string              `json:"detail_url"`
-	HistoryBar    []historyBarSegment `json:"history_bar,omitempty"`
-	LastOK        time.Time           `json:"last_ok"`
-	LastUpdate    time.Time           `json:"last_update"`
-	Median        float64             `json:"median"`
-	MADMultiplier float64             `json:"mad_multiplier"`
-	Status        string              `json:"status"`
-	Title         string              `json:"title"`
-	Value         float64             `json:"value"`
-	ValueHistory  map[int64]float64   `json:"value_history,omitempty"`
+	ID              string                        `json:"id"`
+	Acknowledgement *metricAcknowledgement        `json:"acknowledgement,omitempty"`
+	Config          outputMetricConfig            `json:"config"`
+	Counter         float64                       `json:"counter,omitempty"`
+	Description     string                        `json:"description"`
+	DetailURL       string                        `json:"detail_url"`
+	Detector        outputMetricDetector          `json:"detector"`
+	Flapping        bool                          `json:"flapping"`
+	HistoryBar      []historyBarSegment           `json:"history_bar,omitempty"`
+	JobStart        *time.Time                    `json:"job_start,omitempty"`
+	Labels          map[string]string             `json:"labels,omitempty"`
+	LastOK          time.Time                     `json:"last_ok"`
+	LastUpdate      time.Time                     `json:"last_update"`
+	Median          float64                       `json:"median"`
+	MADMultiplier   float64                       `json:"mad_multiplier"`
+	Maintenance     bool                          `json:"maintenance"`
+	Series          map[string]outputMetricSeries `json:"series,omitempty"`
+	SLA             []slaReport                   `json:"sla,omitempty"`
+	Status          string                        `json:"status"`
+	Title           string                        `json:"title"`
+	Value           float64                       `json:"value"`
+	ValueFormatted  string                        `json:"value_formatted"`
+	ValueHistory    map[int64]float64             `json:"value_history,omitempty"`
+}
+
+type outputMetricSettings struct {
+	Detector           string  `json:"detector"`
+	Expires            int64   `json:"expires"`
+	Freshness          int64   `json:"freshness"`
+	IgnoreMAD          bool    `json:"ignore_mad"`
+	StalenessStatus    string  `json:"staleness_status"`
+	FlapDetection      bool    `json:"flap_detection"`
+	FlapWindow         int     `json:"flap_window"`
+	FlapThresholdLow   float64 `json:"flap_threshold_low"`
+	FlapThresholdHigh  float64 `json:"flap_threshold_high"`
+	FlapStatus         string  `json:"flap_status"`
+	RequireConsecutive int     `json:"require_consecutive"`
+}
+
+type outputMetricMeta struct {
+	LastUpdate     time.Time `json:"last_update"`
+	LastOK         time.Time `json:"last_ok"`
+	PercOK         float64   `json:"perc_ok"`
+	PercWarn       float64   `json:"perc_warn"`
+	PercCrit       float64   `json:"perc_crit"`
+	Flapping       bool      `json:"flapping"`
+	FlapPercentage float64   `json:"flap_percentage"`
+}
+
+type outputMetricDetail struct {
+	outputMetric
+	Meta     outputMetricMeta     `json:"meta"`
+	Settings outputMetricSettings `json:"settings"`
+}
+
+func outputMetricDetailFromMetric(opts outputMetricFromMetricOpts) outputMetricDetail {
+	var (
+		m                 = opts.Metric
+		flapLow, flapHigh = m.flapThresholds()
+	)
+
+	staleness := m.StalenessStatus
+	if staleness == "" {
+		staleness = defaultStalenessStatus.String()
+	}
+
+	return outputMetricDetail{
+		outputMetric: outputMetricFromMetric(opts),
+
+		Meta: outputMetricMeta{
+			LastUpdate:     m.Meta.LastUpdate,
+			LastOK:         m.Meta.LastOK,
+			PercOK:         m.Meta.PercOK,
+			PercWarn:       m.Meta.PercWarn,
+			PercCrit:       m.Meta.PercCrit,
+			Flapping:       m.Meta.Flapping,
+			FlapPercentage: m.Meta.FlapPercentage,
+		},
+
+		Settings: outputMetricSettings{
+			Detector:           m.DetectorName(),
+			Expires:            m.Expires,
+			Freshness:          m.Freshness,
+			IgnoreMAD:          m.IgnoreMAD,
+			StalenessStatus:    staleness,
+			FlapDetection:      m.FlapDetection,
+			FlapWindow:         m.flapWindow(),
+			FlapThresholdLow:   flapLow,
+			FlapThresholdHigh:  flapHigh,
+			FlapStatus:         m.FlapStatus,
+			RequireConsecutive: m.RequireConsecutive,
+		},
+	}
+}
+
+type outputMaintenanceWindow struct {
+	*maintenanceWindow
+	Active bool `json:"active"`
 }
 
 type outputMetricFromMetricOpts struct {
 	Metric          *dashboardMetric
 	AddHistoryBar   bool
+	AddSLA          bool
 	AddValueHistory bool
 }
 
 func outputMetricFromMetric(opts outputMetricFromMetricOpts) outputMetric {
 	out := outputMetric{
-		ID:            opts.Metric.MetricID,
-		Description:   opts.Metric.Description,
-		DetailURL:     opts.Metric.DetailURL,
-		LastOK:        opts.Metric.Meta.LastOK,
-		LastUpdate:    opts.Metric.Meta.LastUpdate,
-		Median:        opts.Metric.Median(),
-		MADMultiplier: opts.Metric.MadMultiplier(),
-		Status:        opts.Metric.PreferredStatus(),
-		Title:         opts.Metric.Title,
-		Value:         opts.Metric.Value,
+		ID:              opts.Metric.MetricID,
+		Acknowledgement: opts.Metric.Acknowledgement,
+		Counter:         opts.Metric.Counter,
+		Description:     opts.Metric.Description,
+		DetailURL:       opts.Metric.DetailURL,
+		Detector:        outputMetricDetector{Name: opts.Metric.DetectorName(), detectorResult: opts.Metric.Detect()},
+		Flapping:        opts.Metric.Meta.Flapping,
+		JobStart:        opts.Metric.Meta.JobStart,
+		Labels:          opts.Metric.Labels,
+		LastOK:          opts.Metric.Meta.LastOK,
+		LastUpdate:      opts.Metric.Meta.LastUpdate,
+		Median:          opts.Metric.Median(),
+		MADMultiplier:   opts.Metric.MadMultiplier(),
+		Maintenance:     opts.Metric.InMaintenance(),
+		Status:          opts.Metric.PreferredStatus(),
+		Title:           opts.Metric.Title,
+		Value:           opts.Metric.Value,
+		ValueFormatted:  opts.Metric.FormattedValue(),
 
 		Config: outputMetricConfig{
 			HideMAD:   opts.Metric.HideMAD,
 			HideValue: opts.Metric.HideValue,
+			Precision: opts.Metric.DisplayPrecision(),
+			Type:      opts.Metric.MetricType(),
+			Unit:      opts.Metric.Unit,
 		},
 	}
 
@@ -71,6 +194,37 @@ func outputMetricFromMetric(opts outputMetricFromMetricOpts) outputMetric {
 		out.HistoryBar = opts.Metric.GetHistoryBar()
 	}
 
+	if names := opts.Metric.SeriesNames(); len(names) > 0 {
+		out.Series = map[string]outputMetricSeries{}
+
+		for _, name := range names {
+			var (
+				detected              = opts.Metric.DetectSeries(name)
+				medianValue, madMulti = opts.Metric.SeriesMedianAndMultiplier(name)
+				value                 = opts.Metric.Values[name]
+			)
+
+			series := outputMetricSeries{
+				Detector:       outputMetricDetector{Name: opts.Metric.DetectorName(), detectorResult: detected},
+				Median:         medianValue,
+				MADMultiplier:  madMulti,
+				Status:         detected.Status.String(),
+				Value:          value,
+				ValueFormatted: formatValue(value, opts.Metric.Unit, opts.Metric.DisplayPrecision()),
+			}
+
+			if opts.AddValueHistory {
+				series.ValueHistory = opts.Metric.SeriesValueMap(name)
+			}
+
+			out.Series[name] = series
+		}
+	}
+
+	if opts.AddSLA {
+		out.SLA = opts.Metric.SLAReports(time.Now())
+	}
+
 	if opts.AddValueHistory {
 		out.ValueHistory = opts.Metric.HistoricalValueMap()
 	}
@@ -78,6 +232,98 @@ func outputMetricFromMetric(opts outputMetricFromMetricOpts) outputMetric {
 	return out
 }
 
+// requestToken extracts the API token from the request: It might be
+// passed as bare, "Token" or "Bearer" authorization or as password of a
+// basic authorization
+func requestToken(r *http.Request) string {
+	if _, pass, ok := r.BasicAuth(); ok {
+		return pass
+	}
+
+	auth := r.Header.Get("Authorization")
+	for _, prefix := range []string{"Token ", "Bearer "} {
+		if strings.HasPrefix(auth, prefix) {
+			return strings.TrimPrefix(auth, prefix)
+		}
+	}
+
+	// Keep compatibility with clients sending the bare token
+	return auth
+}
+
+// writeUpdateError translates errors of the shared update path
+// into HTTP responses
+func writeUpdateError(w http.ResponseWriter, dashid string, err error) {
+	if _, ok := errors.Cause(err).(invalidDataError); ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := errors.Cause(err).(quotaExceededError); ok {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	switch errors.Cause(err) {
+	case errAPIKeyInsecure:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+	case errAPIKeyMismatch:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+
+	default:
+		log.WithError(err).
+			WithField("dashboard_id", dashid).
+			Error("Unable to update dashboard")
+		http.Error(w, "Could not update dashboard", http.StatusInternalServerError)
+	}
+}
+
+// updateDashboard applies the changes to the dashboard using
+// updateStoredDashboard and writes the error response if the update
+// failed. False is returned in that case.
+func updateDashboard(w http.ResponseWriter, dashid, token string, apply func(*dashboard) error) bool {
+	if err := updateStoredDashboard(dashid, token, store, apply); err != nil {
+		writeUpdateError(w, dashid, err)
+		return false
+	}
+	return true
+}
+
+// dashboardFromRequest loads the dashboard referenced in the request and
+// writes the error response if it could not be loaded or the request is
+// not authorized to modify it
+func dashboardFromRequest(w http.ResponseWriter, r *http.Request, authorize bool) (*dashboard, bool) {
+	var (
+		token = requestToken(r)
+		vars  = mux.Vars(r)
+	)
+
+	dash, err := loadDashboard(vars["dashid"], store)
+	switch err {
+	case nil:
+		// All fine
+
+	case errDashboardNotFound:
+		http.Error(w, "Dashboard not found", http.StatusNotFound)
+		return nil, false
+
+	default:
+		log.WithError(err).
+			WithField("dashboard_id", vars["dashid"]).
+			Error("Unable to load dashboard")
+		http.Error(w, "Could not load dashboard", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if authorize && dash.APIKey != token {
+		http.Error(w, "APIKey did not match.", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return dash, true
+}
+
 func handleStaticFile(w http.ResponseWriter, r *http.Request, filename string) error {
 	if _, err := os.Stat(path.Join(cfg.FrontendDir, filename)); err == nil {
 		http.ServeFile(w, r, path.Join(cfg.FrontendDir, filename))
@@ -135,39 +381,107 @@ func handleDisplayDashboardJSON(w http.ResponseWriter, r *http.Request) {
 
 	var (
 		addHistoryBar   = r.URL.Query().Get("history_bar") == "true"
+		addSLA          = r.URL.Query().Get("sla") == "true"
 		addValueHistory = r.URL.Query().Get("value_history") == "true"
 		response        = output{}
 	)
 
 	// Filter out expired metrics
 	for _, m := range dash.Metrics {
-		if m.Meta.LastUpdate.After(time.Now().Add(time.Duration(m.Expires*-1) * time.Second)) {
+		if !m.IsExpired(time.Now()) {
 			response.Metrics = append(response.Metrics, outputMetricFromMetric(outputMetricFromMetricOpts{
 				AddHistoryBar:   addHistoryBar,
+				AddSLA:          addSLA,
 				AddValueHistory: addValueHistory,
 				Metric:          m,
 			}))
 		}
 	}
 
-	sort.Slice(response.Metrics, func(j, i int) bool { return response.Metrics[i].LastUpdate.Before(response.Metrics[j].LastUpdate) })
+	sort.Slice(response.Metrics, func(i, j int) bool {
+		// Acknowledged metrics are sorted below all unacknowledged ones
+		if iAck, jAck := response.Metrics[i].Acknowledgement != nil, response.Metrics[j].Acknowledgement != nil; iAck != jAck {
+			return jAck
+		}
+		return response.Metrics[j].LastUpdate.Before(response.Metrics[i].LastUpdate)
+	})
 
 	if len(response.Metrics) == 0 {
 		response.APIKey = dash.APIKey
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	var lastModified time.Time
+	for _, m := range response.Metrics {
+		if m.LastUpdate.After(lastModified) {
+			lastModified = m.LastUpdate
+		}
+	}
+
+	// Only the ETag is used for conditional requests as the status of
+	// metrics might change (staleness) without an update
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
 	w.Header().Set("Cache-Control", "no-cache")
 
-	if err = json.NewEncoder(w).Encode(response); err != nil {
+	writeJSONWithETag(w, r, response)
+}
+
+func handleDisplayMetricJSON(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	dash, ok := dashboardFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	metric := dash.getMetric(vars["metricid"])
+	if metric == nil || metric.IsExpired(time.Now()) {
+		http.Error(w, "Metric not found", http.StatusNotFound)
+		return
+	}
+
+	response := outputMetricDetailFromMetric(outputMetricFromMetricOpts{
+		AddHistoryBar:   r.URL.Query().Get("history_bar") != "false",
+		AddSLA:          r.URL.Query().Get("sla") == "true",
+		AddValueHistory: r.URL.Query().Get("value_history") == "true",
+		Metric:          metric,
+	})
+
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSONWithETag(w, r, response)
+}
+
+// writeJSONWithETag encodes the response, tags it with a hash of its
+// content and answers with 304 if the client already has this version
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
 		log.WithError(err).Error("Unable to encode API JSON")
 		http.Error(w, "Unable to encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf("%q", fmt.Sprintf("%x", sha1.Sum(body)))
+	w.Header().Set("ETag", etag)
+
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(append(body, '\n')); err != nil {
+		log.WithError(err).Error("Unable to write API JSON")
 	}
 }
 
 func handleDeleteDashboard(w http.ResponseWriter, r *http.Request) {
 	var (
-		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+		token = requestToken(r)
 		vars  = mux.Vars(r)
 	)
 
@@ -204,7 +518,7 @@ func handleDeleteDashboard(w http.ResponseWriter, r *http.Request) {
 
 func handleDeleteMetric(w http.ResponseWriter, r *http.Request) {
 	var (
-		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+		token = requestToken(r)
 		vars  = mux.Vars(r)
 	)
 
@@ -247,71 +561,685 @@ func handleDeleteMetric(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "OK", http.StatusOK)
 }
 
+// metricTimestamp accepts timestamps as unix timestamp (number or
+// string) or as RFC3339 string
+type metricTimestamp time.Time
+
+func (m *metricTimestamp) UnmarshalJSON(data []byte) error {
+	var f float64
+	if err := json.Unmarshal(data, &f); err == nil {
+		sec, frac := math.Modf(f)
+		*m = metricTimestamp(time.Unix(int64(sec), int64(frac*float64(time.Second))))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "Timestamp must be number or string")
+	}
+
+	t, err := parseTimeParam(s)
+	if err != nil {
+		return errors.Wrap(err, "Invalid timestamp")
+	}
+
+	*m = metricTimestamp(t)
+	return nil
+}
+
 func handlePutMetric(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	metricUpdate := newDashboardMetric()
+	input := struct {
+		*dashboardMetric
+		Timestamp metricTimestamp `json:"timestamp"`
+	}{dashboardMetric: metricUpdate}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Unable to unmarshal json body", http.StatusBadRequest)
+		return
+	}
+
+	if ts := time.Time(input.Timestamp); !ts.IsZero() {
+		metricUpdate.Timestamp = ts
+	}
+
+	if !updateDashboard(w, vars["dashid"], requestToken(r), func(dash *dashboard) error {
+		return dash.applyMetricUpdate(vars["metricid"], metricUpdate)
+	}) {
+		return
+	}
+
+	http.Error(w, "OK", http.StatusOK)
+}
+
+func handleHeartbeat(event string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			err       error
+			freshness int64
+			vars      = mux.Vars(r)
+		)
+
+		if v := r.URL.Query().Get("freshness"); v != "" {
+			if freshness, err = strconv.ParseInt(v, 10, 64); err != nil || freshness < 1 {
+				http.Error(w, "Invalid freshness", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if !updateDashboard(w, vars["dashid"], checkInToken(r), func(dash *dashboard) error {
+			return dash.recordHeartbeat(vars["metricid"], event, freshness, time.Now())
+		}) {
+			return
+		}
+
+		http.Error(w, "OK", http.StatusOK)
+	}
+}
+
+func handleInfluxWrite(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	precision, ok := influxPrecisions[r.URL.Query().Get("precision")]
+	if !ok {
+		http.Error(w, "Invalid precision", http.StatusBadRequest)
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		// Telegraf compresses the body by default
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	points, err := parseInfluxLines(body, precision, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to parse body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if !updateDashboard(w, vars["dashid"], requestToken(r), func(dash *dashboard) error {
+		return dash.applyInfluxPoints(points)
+	}) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handlePushgateway(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	group, err := parseGroupingKey("job/" + vars["grouping"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid grouping key: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Content-Type"), "protobuf") {
+		http.Error(w, "Only the text exposition format is supported, use expfmt.FmtText for Go pushers", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var samples []exposedSample
+	if r.Method != http.MethodDelete {
+		if samples, err = parseExposition(r.Body, time.Now()); err != nil {
+			http.Error(w, fmt.Sprintf("Unable to parse body: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !updateDashboard(w, vars["dashid"], requestToken(r), func(dash *dashboard) error {
+		if r.Method == http.MethodDelete {
+			dash.deleteMetricGroup(group)
+			return nil
+		}
+
+		// PUT replaces the whole group, POST only metrics with the same name
+		return dash.applyPushgatewaySamples(group, samples, r.Method == http.MethodPut)
+	}) {
+		return
+	}
+
+	http.Error(w, "OK", http.StatusOK)
+}
+
+func handleAlertmanagerWebhook(w http.ResponseWriter, r *http.Request) {
 	var (
-		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
-		vars  = mux.Vars(r)
+		params = r.URL.Query()
+		vars   = mux.Vars(r)
+		opts   = alertmanagerOptions{
+			Freshness:     alertmanagerDefaultFreshness,
+			SeverityLabel: alertmanagerDefaultSeverityLabel,
+		}
+		err error
 	)
 
-	metricUpdate := newDashboardMetric()
-	if err := json.NewDecoder(r.Body).Decode(metricUpdate); err != nil {
+	if v := params.Get("id_template"); v != "" {
+		if opts.IDTemplate, err = template.New("id").Option("missingkey=zero").Parse(v); err != nil {
+			http.Error(w, "Invalid id_template", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if v := params.Get("severity_label"); v != "" {
+		opts.SeverityLabel = v
+	}
+
+	if v := params.Get("freshness"); v != "" {
+		if opts.Freshness, err = strconv.ParseInt(v, 10, 64); err != nil || opts.Freshness < 1 {
+			http.Error(w, "Invalid freshness", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var hook alertmanagerWebhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
 		http.Error(w, "Unable to unmarshal json body", http.StatusBadRequest)
 		return
 	}
 
-	dash, err := loadDashboard(vars["dashid"], store)
-	switch err {
-	case nil:
-		// All fine
+	if !updateDashboard(w, vars["dashid"], requestToken(r), func(dash *dashboard) error {
+		return dash.applyAlertmanagerWebhook(hook, opts)
+	}) {
+		return
+	}
 
-	case errDashboardNotFound:
-		// Dashboard may be created with first metrics put
-		if len(token) < 10 {
-			http.Error(w, "APIKey is too insecure", http.StatusBadRequest)
+	http.Error(w, "OK", http.StatusOK)
+}
+
+func handleCheckResult(w http.ResponseWriter, r *http.Request) {
+	var (
+		params    = r.URL.Query()
+		vars      = mux.Vars(r)
+		freshness int64
+		results   []checkResult
+		err       error
+	)
+
+	if v := params.Get("freshness"); v != "" {
+		if freshness, err = strconv.ParseInt(v, 10, 64); err != nil || freshness < 1 {
+			http.Error(w, "Invalid freshness", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if strings.Contains(r.Header.Get("Content-Type"), "json") {
+		var (
+			icingaResult icingaCheckResult
+			res          checkResult
+		)
+
+		if err := json.NewDecoder(r.Body).Decode(&icingaResult); err != nil {
+			http.Error(w, "Unable to unmarshal json body", http.StatusBadRequest)
 			return
 		}
 
-		dash = &dashboard{
-			APIKey:      token,
-			Metrics:     []*dashboardMetric{},
-			DashboardID: vars["dashid"],
-			storage:     store,
+		object := params.Get("service")
+		if object == "" {
+			object = params.Get("host")
+		}
+
+		if res, err = icingaResult.checkResult(object); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid check result: %s", err), http.StatusBadRequest)
+			return
+		}
+		res.Timestamp = time.Now()
+		results = []checkResult{res}
+	} else if results, err = parseExternalCommands(r.Body, time.Now()); err != nil {
+		http.Error(w, fmt.Sprintf("Unable to parse body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if !updateDashboard(w, vars["dashid"], requestToken(r), func(dash *dashboard) error {
+		return dash.applyCheckResults(results, freshness)
+	}) {
+		return
+	}
+
+	http.Error(w, "OK", http.StatusOK)
+}
+
+func handleAcknowledgeMetric(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	dash, ok := dashboardFromRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	metric := dash.getMetric(vars["metricid"])
+	if metric == nil {
+		http.Error(w, "Metric not found", http.StatusNotFound)
+		return
+	}
+
+	ack := &metricAcknowledgement{}
+	if err := json.NewDecoder(r.Body).Decode(ack); err != nil {
+		http.Error(w, "Unable to unmarshal json body", http.StatusBadRequest)
+		return
+	}
+
+	if ack.Author == "" || ack.Comment == "" {
+		http.Error(w, "Invalid data: Author and Comment are required", http.StatusBadRequest)
+		return
+	}
+
+	if len(ack.Author) > 256 || len(ack.Comment) > 1024 {
+		http.Error(w, "Invalid data: Author or Comment too long", http.StatusBadRequest)
+		return
+	}
+
+	ack.Status = metric.PreferredStatus()
+	ack.Time = time.Now()
+
+	if ack.Status == metricStatusOK.String() {
+		http.Error(w, "Metric is in OK state", http.StatusBadRequest)
+		return
+	}
+
+	metric.Acknowledgement = ack
+
+	if err := dash.Save(); err != nil {
+		log.WithError(err).Error("Unable to save dashboard")
+		http.Error(w, "Was not able to save the dashboard", http.StatusInternalServerError)
+		return
+	}
+
+	http.Error(w, "OK", http.StatusOK)
+}
+
+func handleRemoveAcknowledgement(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	dash, ok := dashboardFromRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	metric := dash.getMetric(vars["metricid"])
+	if metric == nil {
+		http.Error(w, "Metric not found", http.StatusNotFound)
+		return
+	}
+
+	metric.Acknowledgement = nil
+
+	if err := dash.Save(); err != nil {
+		log.WithError(err).Error("Unable to save dashboard")
+		http.Error(w, "Was not able to save the dashboard", http.StatusInternalServerError)
+		return
+	}
+
+	http.Error(w, "OK", http.StatusOK)
+}
+
+func handleDashboardStatus(w http.ResponseWriter, r *http.Request) {
+	dash, ok := dashboardFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	status := dash.AggregateStatus()
+
+	code, ok := statusHTTPCodes[status.Status]
+	if !ok {
+		code = http.StatusOK
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.URL.Query().Get("format") == "nagios" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(code)
+		fmt.Fprintf(w, "MONDASH %s - %d metrics: %d critical, %d warning, %d unknown, %d ok, %d in maintenance | ok=%d;;;0 warning=%d;;;0 critical=%d;;;0 unknown=%d;;;0 maintenance=%d;;;0\n",
+			strings.ToUpper(status.Status), status.Metrics,
+			status.Counts[metricStatusCritical.String()], status.Counts[metricStatusWarning.String()],
+			status.Counts[metricStatusUnknown.String()], status.Counts[metricStatusOK.String()], status.Maintenance,
+			status.Counts[metricStatusOK.String()], status.Counts[metricStatusWarning.String()],
+			status.Counts[metricStatusCritical.String()], status.Counts[metricStatusUnknown.String()], status.Maintenance)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.WithError(err).Error("Unable to encode API JSON")
+	}
+}
+
+func handleDashboardBadge(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	dash, ok := dashboardFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		label = vars["dashid"]
+	}
+
+	status := dash.AggregateStatus().Status
+	writeBadge(w, label, status, status)
+}
+
+func handleMetricBadge(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	dash, ok := dashboardFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	metric := dash.getMetric(vars["metricid"])
+	if metric == nil || metric.IsExpired(time.Now()) {
+		http.Error(w, "Metric not found", http.StatusNotFound)
+		return
+	}
+
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		label = metric.Title
+	}
+
+	var (
+		status  = metric.PreferredStatus()
+		message = status
+	)
+
+	if r.URL.Query().Get("value") == "true" {
+		message = fmt.Sprintf("%s | %s", metric.FormattedValue(), status)
+	}
+
+	writeBadge(w, label, message, status)
+}
+
+func writeBadge(w http.ResponseWriter, label, message, status string) {
+	body, err := renderBadge(label, message, status)
+	if err != nil {
+		log.WithError(err).Error("Unable to render badge")
+		http.Error(w, "Unable to render badge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cfg.BadgeCacheTime/time.Second)))
+	w.Header().Set("Expires", time.Now().Add(cfg.BadgeCacheTime).UTC().Format(http.TimeFormat))
+
+	if _, err = w.Write(body); err != nil {
+		log.WithError(err).Error("Unable to write badge")
+	}
+}
+
+func handleStatusFeed(w http.ResponseWriter, r *http.Request) {
+	dash, ok := dashboardFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	lookback := cfg.FeedLookback
+	if v := r.URL.Query().Get("lookback"); v != "" {
+		var err error
+		if lookback, err = time.ParseDuration(v); err != nil || lookback <= 0 {
+			http.Error(w, "Invalid lookback duration", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		log.WithError(err).Error("Unable to write feed")
+		return
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(buildStatusFeed(dash, time.Now().Add(-lookback))); err != nil {
+		log.WithError(err).Error("Unable to encode feed")
+	}
+}
+
+func handleMetricHistory(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	dash, ok := dashboardFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	metric := dash.getMetric(vars["metricid"])
+	if metric == nil || metric.IsExpired(time.Now()) {
+		http.Error(w, "Metric not found", http.StatusNotFound)
+		return
+	}
+
+	from, err := parseTimeParam(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from parameter", http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeParam(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid to parameter", http.StatusBadRequest)
+		return
+	}
+
+	history := metric.exportHistory(from, to)
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		format = "csv"
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", vars["metricid"]+".csv"))
+
+		// Every named value gets its own column, empty for points not
+		// carrying that value
+		seriesNames := map[string]bool{}
+		for _, p := range history {
+			for name := range p.Values {
+				seriesNames[name] = true
+			}
+		}
+
+		series := []string{}
+		for name := range seriesNames {
+			series = append(series, name)
+		}
+		sort.Strings(series)
+
+		formatFloat := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+		cw := csv.NewWriter(w)
+		cw.Write(append([]string{"time", "status", "value", "resolution", "min", "max", "count"}, series...))
+		for _, p := range history {
+			row := []string{p.Time.Format(time.RFC3339Nano), p.Status, formatFloat(p.Value), "", "", "", ""}
+			if p.Rollup != nil {
+				row[3] = strconv.FormatInt(p.Rollup.Resolution, 10)
+				row[4] = formatFloat(p.Rollup.Min)
+				row[5] = formatFloat(p.Rollup.Max)
+				row[6] = strconv.Itoa(p.Rollup.Count)
+			}
+
+			for _, name := range series {
+				v, ok := p.Values[name]
+				if !ok {
+					row = append(row, "")
+					continue
+				}
+				row = append(row, formatFloat(v))
+			}
+
+			cw.Write(row)
+		}
+		cw.Flush()
+
+		if err := cw.Error(); err != nil {
+			log.WithError(err).Error("Unable to write CSV")
+		}
+
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(history); err != nil {
+			log.WithError(err).Error("Unable to encode API JSON")
+			http.Error(w, "Unable to encode JSON", http.StatusInternalServerError)
 		}
 
 	default:
-		log.WithError(err).
-			WithField("dashboard_id", vars["dashid"]).
-			Error("Unable to load dashboard")
-		http.Error(w, "Could not load dashboard", http.StatusInternalServerError)
+		http.Error(w, "Unsupported format", http.StatusBadRequest)
+	}
+}
+
+func handleMetricSLA(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	dash, ok := dashboardFromRequest(w, r, false)
+	if !ok {
 		return
 	}
 
-	if dash.APIKey != token {
-		http.Error(w, "APIKey did not match.", http.StatusUnauthorized)
+	metric := dash.getMetric(vars["metricid"])
+	if metric == nil || metric.IsExpired(time.Now()) {
+		http.Error(w, "Metric not found", http.StatusNotFound)
 		return
 	}
 
-	valid, reason := metricUpdate.IsValid()
-	if !valid {
+	var (
+		now      = time.Now()
+		response = metric.SLAReports(now)
+	)
+
+	if period := r.URL.Query().Get("period"); period != "" {
+		start, ok := slaPeriodStart(period, now)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown period, use one of: %s", strings.Join(slaPeriods, ", ")), http.StatusBadRequest)
+			return
+		}
+
+		response = []slaReport{metric.SLA(period, start, now)}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSONWithETag(w, r, response)
+}
+
+// parseTimeParam accepts RFC3339 times and unix timestamps, empty values
+// result in a zero time
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, v)
+}
+
+func handleListMaintenance(w http.ResponseWriter, r *http.Request) {
+	dash, ok := dashboardFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	var (
+		now      = time.Now()
+		response = []outputMaintenanceWindow{}
+	)
+
+	for _, mw := range dash.Maintenance {
+		response = append(response, outputMaintenanceWindow{maintenanceWindow: mw, Active: mw.IsActive(now)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.WithError(err).Error("Unable to encode API JSON")
+		http.Error(w, "Unable to encode JSON", http.StatusInternalServerError)
+	}
+}
+
+func handlePutMaintenance(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	mw := &maintenanceWindow{}
+	if err := json.NewDecoder(r.Body).Decode(mw); err != nil {
+		http.Error(w, "Unable to unmarshal json body", http.StatusBadRequest)
+		return
+	}
+	mw.ID = vars["windowid"]
+
+	if valid, reason := mw.IsValid(); !valid {
 		http.Error(w, fmt.Sprintf("Invalid data: %s", reason), http.StatusBadRequest)
 		return
 	}
 
-	updated := false
-	for _, m := range dash.Metrics {
-		if m.MetricID == vars["metricid"] {
-			m.Update(metricUpdate)
-			updated = true
-			break
+	dash, ok := dashboardFromRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	dash.removeFinishedMaintenance(time.Now())
+
+	tmp := []*maintenanceWindow{mw}
+	for _, existing := range dash.Maintenance {
+		if existing.ID != mw.ID {
+			tmp = append(tmp, existing)
 		}
 	}
 
-	if !updated {
-		tmp := newDashboardMetric()
-		tmp.MetricID = vars["metricid"]
-		tmp.Update(metricUpdate)
-		dash.Metrics = append(dash.Metrics, tmp)
+	if len(tmp) > maxMaintenanceWindows {
+		http.Error(w, "Too many maintenance windows", http.StatusBadRequest)
+		return
+	}
+	dash.Maintenance = tmp
+
+	if err := dash.Save(); err != nil {
+		log.WithError(err).Error("Unable to save dashboard")
+		http.Error(w, "Was not able to save the dashboard", http.StatusInternalServerError)
+		return
+	}
+
+	http.Error(w, "OK", http.StatusOK)
+}
+
+func handleDeleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	var vars = mux.Vars(r)
+
+	dash, ok := dashboardFromRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	tmp := []*maintenanceWindow{}
+	for _, mw := range dash.Maintenance {
+		if mw.ID != vars["windowid"] {
+			tmp = append(tmp, mw)
+		}
 	}
+	dash.Maintenance = tmp
 
 	if err := dash.Save(); err != nil {
 		log.WithError(err).Error("Unable to save dashboard")